@@ -0,0 +1,252 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pillar-bank/tracing"
+)
+
+// actions recorded in the audit log
+const (
+	ActionLogin        = "auth.login"
+	ActionDenied       = "auth.denied"
+	ActionWireCreate   = "wire.create"
+	ActionWireRead     = "wire.read"
+	ActionWireList     = "wire.list"
+	ActionWireUnmask   = "wire.unmask"
+	ActionWireReview   = "wire.review"
+	ActionWireOverride = "wire.override"
+	ActionWireRelease  = "wire.release"
+	ActionAuditQuery   = "audit.query"
+)
+
+// SystemActor is the actor of entries written by the server itself rather
+// than on behalf of a user
+const SystemActor = "system"
+
+// outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// GenesisHash is the previous hash of the first entry in the chain
+var GenesisHash = strings.Repeat("0", 64)
+
+// Entry is a single row of the audit trail
+type Entry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	IP        string    `json:"ip"`
+	RequestID string    `json:"request_id"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Outcome   string    `json:"outcome"`
+	Detail    string    `json:"detail"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// ComputeHash returns the chained hash of the entry. Every recorded field and
+// the previous entry's hash are covered; the database id is not.
+func (e Entry) ComputeHash() string {
+	canonical, _ := json.Marshal([]string{
+		e.PrevHash,
+		e.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.Actor,
+		e.IP,
+		e.RequestID,
+		e.Action,
+		e.Resource,
+		e.Outcome,
+		e.Detail,
+	})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify walks entries in chain order and returns an error describing the
+// first entry whose hash or link to its predecessor does not match
+func Verify(entries []Entry) error {
+	prev := GenesisHash
+	for _, e := range entries {
+		if e.PrevHash != prev {
+			return fmt.Errorf("audit entry %d: previous hash mismatch", e.ID)
+		}
+		if e.ComputeHash() != e.Hash {
+			return fmt.Errorf("audit entry %d: hash mismatch", e.ID)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// Filter narrows an audit query; zero values match everything
+type Filter struct {
+	Actor   string
+	Action  string
+	Outcome string
+	From    time.Time
+	To      time.Time
+	Limit   int
+	Offset  int
+}
+
+// Log is an append-only, hash-chained audit trail stored in Postgres.
+// A nil *Log discards everything, which keeps handlers usable without one.
+type Log struct {
+	db *sql.DB
+}
+
+// NewLog creates an audit log backed by the audit_log table
+func NewLog(db *sql.DB) *Log {
+	return &Log{db: db}
+}
+
+const entryColumns = "id, occurred_at, actor, ip, request_id, action, resource, outcome, detail, prev_hash, hash"
+
+// scans a row selected with entryColumns
+func scanEntry(row interface{ Scan(...interface{}) error }, e *Entry) error {
+	err := row.Scan(&e.ID, &e.Timestamp, &e.Actor, &e.IP, &e.RequestID, &e.Action,
+		&e.Resource, &e.Outcome, &e.Detail, &e.PrevHash, &e.Hash)
+	e.Timestamp = e.Timestamp.UTC()
+	return err
+}
+
+// Append links the entry to the end of the chain and stores it
+func (l *Log) Append(ctx context.Context, e Entry) (Entry, error) {
+	if l == nil {
+		return e, nil
+	}
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return e, err
+	}
+	defer tx.Rollback()
+
+	// serialize appenders so two entries never share a predecessor
+	lock := "LOCK TABLE audit_log IN EXCLUSIVE MODE"
+	lockCtx, span := tracing.StartSQL(ctx, "LOCK", lock)
+	_, err = tx.ExecContext(lockCtx, lock)
+	tracing.End(span, err)
+	if err != nil {
+		return e, err
+	}
+
+	last := "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1"
+	lastCtx, span := tracing.StartSQL(ctx, "SELECT", last)
+	err = tx.QueryRowContext(lastCtx, last).Scan(&e.PrevHash)
+	if err == sql.ErrNoRows {
+		e.PrevHash = GenesisHash
+		err = nil
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return e, err
+	}
+
+	// postgres keeps microseconds, so hash what will be read back
+	e.Timestamp = time.Now().UTC().Truncate(time.Microsecond)
+	e.Hash = e.ComputeHash()
+
+	query := `INSERT INTO audit_log (occurred_at, actor, ip, request_id, action, resource, outcome, detail, prev_hash, hash)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			 RETURNING id`
+	insertCtx, span := tracing.StartSQL(ctx, "INSERT", query)
+	err = tx.QueryRowContext(insertCtx, query, e.Timestamp, e.Actor, e.IP, e.RequestID, e.Action, e.Resource,
+		e.Outcome, e.Detail, e.PrevHash, e.Hash).Scan(&e.ID)
+	tracing.End(span, err)
+	if err != nil {
+		return e, err
+	}
+
+	return e, tx.Commit()
+}
+
+// Query returns entries matching the filter, oldest first
+func (l *Log) Query(ctx context.Context, f Filter) ([]Entry, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Actor != "" {
+		add("actor = $%d", f.Actor)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.Outcome != "" {
+		add("outcome = $%d", f.Outcome)
+	}
+	if !f.From.IsZero() {
+		add("occurred_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("occurred_at < $%d", f.To)
+	}
+
+	query := "SELECT " + entryColumns + " FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id ASC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit, f.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	defer span.End()
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		if err := scanEntry(rows, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// VerifyChain reads the whole stored chain and checks it with Verify,
+// returning the number of entries read along with the first inconsistency
+func (l *Log) VerifyChain() (int, error) {
+	rows, err := l.db.Query("SELECT " + entryColumns + " FROM audit_log ORDER BY id ASC")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := scanEntry(rows, &e); err != nil {
+			return len(entries), err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return len(entries), err
+	}
+	return len(entries), Verify(entries)
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// builds a valid chain of n entries
+func buildChain(n int) []Entry {
+	entries := make([]Entry, 0, n)
+	prev := GenesisHash
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		e := Entry{
+			ID:        int64(i + 1),
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Actor:     "user1",
+			IP:        "127.0.0.1",
+			RequestID: fmt.Sprintf("req-%d", i),
+			Action:    ActionWireRead,
+			Resource:  fmt.Sprintf("wire:%d", i),
+			Outcome:   OutcomeSuccess,
+			PrevHash:  prev,
+		}
+		e.Hash = e.ComputeHash()
+		prev = e.Hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestComputeHash(t *testing.T) {
+	e := buildChain(1)[0]
+
+	assert.Len(t, e.Hash, 64)
+	assert.Equal(t, e.Hash, e.ComputeHash(), "hash should be deterministic")
+
+	// the same instant in another zone hashes identically
+	local := e
+	local.Timestamp = e.Timestamp.In(time.FixedZone("EST", -5*60*60))
+	assert.Equal(t, e.Hash, local.ComputeHash())
+
+	// field boundaries are unambiguous
+	shifted := e
+	shifted.Actor, shifted.IP = "user", "1127.0.0.1"
+	assert.NotEqual(t, e.Hash, shifted.ComputeHash())
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("Valid chain", func(t *testing.T) {
+		assert.NoError(t, Verify(buildChain(5)))
+	})
+
+	t.Run("Empty chain", func(t *testing.T) {
+		assert.NoError(t, Verify(nil))
+	})
+
+	t.Run("Tampered field", func(t *testing.T) {
+		chain := buildChain(5)
+		chain[2].Outcome = OutcomeFailure
+		assert.EqualError(t, Verify(chain), "audit entry 3: hash mismatch")
+	})
+
+	t.Run("Rehashed entry breaks the next link", func(t *testing.T) {
+		chain := buildChain(5)
+		chain[2].Actor = "user2"
+		chain[2].Hash = chain[2].ComputeHash()
+		assert.EqualError(t, Verify(chain), "audit entry 4: previous hash mismatch")
+	})
+
+	t.Run("Deleted entry", func(t *testing.T) {
+		chain := buildChain(5)
+		chain = append(chain[:1], chain[2:]...)
+		assert.EqualError(t, Verify(chain), "audit entry 3: previous hash mismatch")
+	})
+
+	t.Run("Reordered entries", func(t *testing.T) {
+		chain := buildChain(5)
+		chain[1], chain[2] = chain[2], chain[1]
+		assert.EqualError(t, Verify(chain), "audit entry 3: previous hash mismatch")
+	})
+}
@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"net/http"
+
+	"pillar-bank/auth"
+	"pillar-bank/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// set on the context once a request has written its own audit entry
+const recordedKey = "audit.recorded"
+
+// Record appends an entry for the current request, filling in the actor,
+// client IP and request id. Failures are logged rather than surfaced so an
+// audit outage does not take the API down with it.
+func (l *Log) Record(c *gin.Context, action, resource, outcome, detail string) {
+	l.RecordAs(c, auth.Subject(c), action, resource, outcome, detail)
+}
+
+// RecordAs is Record for requests whose actor is not yet authenticated,
+// such as a login attempt
+func (l *Log) RecordAs(c *gin.Context, actor, action, resource, outcome, detail string) {
+	if l == nil {
+		return
+	}
+
+	c.Set(recordedKey, true)
+
+	_, err := l.Append(c.Request.Context(), Entry{
+		Actor:     actor,
+		IP:        c.ClientIP(),
+		RequestID: logging.GetRequestID(c),
+		Action:    action,
+		Resource:  resource,
+		Outcome:   outcome,
+		Detail:    detail,
+	})
+	if err != nil {
+		logging.FromContext(c).Error("failed to write audit entry", "action", action, "error", err)
+	}
+}
+
+// DenialMiddleware records every 401 and 403 response that the handler
+// chain did not already audit itself
+func (l *Log) DenialMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		if status != http.StatusUnauthorized && status != http.StatusForbidden {
+			return
+		}
+		if c.GetBool(recordedKey) {
+			return
+		}
+
+		l.Record(c, ActionDenied, c.Request.Method+" "+c.Request.URL.Path, OutcomeDenied, http.StatusText(status))
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"pillar-bank/audit"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parses an optional RFC 3339 timestamp query parameter
+func parseTimeQuery(c *gin.Context, name string) (time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, err == nil
+}
+
+// getAuditLog returns a paginated, filtered view of the audit trail
+func (h *Handler) getAuditLog(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "page must be a positive integer")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 1000 {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 1000")
+		return
+	}
+
+	from, ok := parseTimeQuery(c, "from")
+	if !ok {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "from must be an RFC 3339 timestamp")
+		return
+	}
+	to, ok := parseTimeQuery(c, "to")
+	if !ok {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "to must be an RFC 3339 timestamp")
+		return
+	}
+
+	entries, err := h.audit.Query(c.Request.Context(), audit.Filter{
+		Actor:   c.Query("actor"),
+		Action:  c.Query("action"),
+		Outcome: c.Query("outcome"),
+		From:    from,
+		To:      to,
+		Limit:   limit,
+		Offset:  (page - 1) * limit,
+	})
+	if err != nil {
+		problem.Internal(c, "failed to query audit log", err)
+		return
+	}
+
+	// auditors reading the trail are themselves audited
+	h.audit.Record(c, audit.ActionAuditQuery, "audit", audit.OutcomeSuccess, c.Request.URL.RawQuery)
+
+	c.IndentedJSON(http.StatusOK, entries)
+}
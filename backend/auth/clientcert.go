@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+)
+
+// WithClientCerts trusts client certificates whose subject common name is a
+// key of certRoles, granting the listed roles. Certificates must already
+// have been verified against the client CA by the TLS listener.
+func (a *Authenticator) WithClientCerts(certRoles map[string][]string) *Authenticator {
+	a.certRoles = certRoles
+	return a
+}
+
+// VerifiedClientCert returns the leaf certificate the client presented, if
+// the TLS handshake verified it against the client CA
+func VerifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// builds a principal from a verified client certificate
+func (a *Authenticator) principalFromCert(cert *x509.Certificate) (*Principal, error) {
+	name := cert.Subject.CommonName
+	roles, ok := a.certRoles[name]
+	if name == "" || !ok {
+		return nil, fmt.Errorf("client certificate %q is not mapped to a principal", cert.Subject.String())
+	}
+
+	p := &Principal{Subject: name, Roles: []string{}, AuthMethod: MethodClientCert}
+	p.Roles = append(p.Roles, roles...)
+	return p, nil
+}
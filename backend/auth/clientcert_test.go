@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attaches a connection state as if the TLS listener verified a client
+// certificate with the given common name
+func withClientCert(req *http.Request, commonName string) *http.Request {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	return req
+}
+
+func TestAuthenticateClientCert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authn := NewAuthenticator(testSecret, 0).WithClientCerts(map[string][]string{
+		"partner-a": {RoleOperator},
+	})
+
+	router := gin.New()
+	router.GET("/test", authn.AuthenticateMiddleware, func(c *gin.Context) {
+		principal, _ := GetPrincipal(c)
+		c.JSON(http.StatusOK, principal)
+	})
+
+	t.Run("mapped certificate", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClientCert(req, "partner-a"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var principal Principal
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &principal))
+		assert.Equal(t, "partner-a", principal.Subject)
+		assert.Equal(t, []string{RoleOperator}, principal.Roles)
+		assert.Equal(t, MethodClientCert, principal.AuthMethod)
+	})
+
+	t.Run("unmapped certificate", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClientCert(req, "partner-b"))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assertProblem(t, w, problem.CodeUnknownClientCert)
+	})
+
+	t.Run("unverified certificate is ignored", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		req = withClientCert(req, "partner-a")
+		req.TLS.VerifiedChains = nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assertProblem(t, w, problem.CodeAuthenticationRequired)
+	})
+}
+
+// tests that partner banks over mTLS are not subject to browser CSRF checks
+func TestCSRFMiddlewareClientCert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CSRFMiddleware("http://localhost:3000"))
+	router.POST("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodPost, "/test", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, withClientCert(req, "partner-a"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a browser that also holds the login cookie is still checked
+	req, _ = http.NewRequest(http.MethodPost, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: "x"})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withClientCert(req, "partner-a"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// returns true for methods that do not change server state
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// checks if the request carries the login cookie
+func hasTokenCookie(c *gin.Context) bool {
+	_, err := c.Cookie("token")
+	return err == nil
+}
+
+// reduces a URL to its scheme://host[:port] origin
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// CSRFMiddleware rejects state-changing requests that do not come from a
+// trusted origin. The Origin header is checked first and the Referer is used
+// as a fallback; requests carrying neither are rejected since the login
+// cookie alone is not proof the caller is our frontend.
+func CSRFMiddleware(trustedOrigins ...string) gin.HandlerFunc {
+	trusted := make(map[string]bool, len(trustedOrigins))
+	for _, o := range trustedOrigins {
+		trusted[strings.ToLower(strings.TrimRight(o, "/"))] = true
+	}
+
+	return CSRFMiddlewareFunc(func(origin string) bool { return trusted[origin] })
+}
+
+// CSRFMiddlewareFunc is CSRFMiddleware with the trust decision delegated to
+// isTrusted, which receives a lower-cased scheme://host[:port] origin
+func CSRFMiddlewareFunc(isTrusted func(origin string) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		// partner banks calling over mTLS carry no cookie for a forged
+		// request to ride on
+		if VerifiedClientCert(c.Request) != nil && !hasTokenCookie(c) {
+			c.Next()
+			return
+		}
+
+		var origin string
+		if header := c.GetHeader("Origin"); header != "" {
+			origin = originOf(header)
+		} else {
+			origin = originOf(c.GetHeader("Referer"))
+		}
+
+		if origin == "" || !isTrusted(origin) {
+			problem.Abort(c, http.StatusForbidden, problem.CodeCrossSiteRequest, "State-changing requests must come from a trusted origin")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// tests CSRFMiddleware against same-origin and forged cross-origin requests
+func TestCSRFMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(CSRFMiddleware("http://localhost:3000"))
+
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+	router.POST("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		headers       map[string]string
+		expectedCode  int
+		expectedBody  string
+		expectedError string
+	}{
+		{
+			name:         "Same origin post",
+			method:       http.MethodPost,
+			headers:      map[string]string{"Origin": "http://localhost:3000"},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"message":"ok"}`,
+		},
+		{
+			name:         "Same origin referer without origin",
+			method:       http.MethodPost,
+			headers:      map[string]string{"Referer": "http://localhost:3000/wire-messages"},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"message":"ok"}`,
+		},
+		{
+			name:          "Forged cross-origin post",
+			method:        http.MethodPost,
+			headers:       map[string]string{"Origin": "https://evil.example", "Content-Type": "text/plain"},
+			expectedCode:  http.StatusForbidden,
+			expectedError: problem.CodeCrossSiteRequest,
+		},
+		{
+			name:          "Cross-origin referer",
+			method:        http.MethodPost,
+			headers:       map[string]string{"Referer": "https://evil.example/form.html"},
+			expectedCode:  http.StatusForbidden,
+			expectedError: problem.CodeCrossSiteRequest,
+		},
+		{
+			name:   "Trusted referer does not override forged origin",
+			method: http.MethodPost,
+			headers: map[string]string{
+				"Origin":  "https://evil.example",
+				"Referer": "http://localhost:3000/",
+			},
+			expectedCode:  http.StatusForbidden,
+			expectedError: problem.CodeCrossSiteRequest,
+		},
+		{
+			name:          "Opaque null origin",
+			method:        http.MethodPost,
+			headers:       map[string]string{"Origin": "null"},
+			expectedCode:  http.StatusForbidden,
+			expectedError: problem.CodeCrossSiteRequest,
+		},
+		{
+			name:          "No origin or referer",
+			method:        http.MethodPost,
+			expectedCode:  http.StatusForbidden,
+			expectedError: problem.CodeCrossSiteRequest,
+		},
+		{
+			name:         "Cross-origin get is allowed",
+			method:       http.MethodGet,
+			headers:      map[string]string{"Origin": "https://evil.example"},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"message":"ok"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "/test", strings.NewReader("seq=1"))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			req.AddCookie(&http.Cookie{Name: "token", Value: "session"})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedError != "" {
+				assertProblem(t, w, tt.expectedError)
+			} else {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,39 +1,84 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"pillar-bank/problem"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
-// in production this would be stored as a secure environment variable
-var secretKey = []byte("P+4/pZOKEXpyYHC8Dv4NXvxmHYYEAUjTyYtOyVhzKiM=")
+// issuer written to and expected in every token
+const issuer = "pillar-bank"
+
+// Authenticator issues and verifies the JWTs carried in the login cookie
+type Authenticator struct {
+	secret    []byte
+	ttl       time.Duration
+	certRoles map[string][]string
+}
+
+// NewAuthenticator signs tokens with secret and expires them after ttl
+func NewAuthenticator(secret []byte, ttl time.Duration) *Authenticator {
+	return &Authenticator{secret: secret, ttl: ttl}
+}
+
+// TokenTTL is how long an issued token stays valid
+func (a *Authenticator) TokenTTL() time.Duration {
+	return a.ttl
+}
+
+// generates a random identifier for the jti claim
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// generates a JWT token that expires after the configured TTL
+func (a *Authenticator) CreateToken(username string, roles ...string) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	if roles == nil {
+		roles = []string{}
+	}
 
-// generates a JWT token with a 15 minute expiration
-func CreateToken(username string) (string, error) {
 	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": username,
-		"iss": "pillar-bank",
-		"exp": time.Now().Add(15 * time.Minute).Unix(),
-		"iat": time.Now().Unix(),
+		"sub":   username,
+		"iss":   issuer,
+		"jti":   tokenID,
+		"roles": roles,
+		"exp":   time.Now().Add(a.ttl).Unix(),
+		"iat":   time.Now().Unix(),
 	})
 
-	tokenString, err := claims.SignedString(secretKey)
+	tokenString, err := claims.SignedString(a.secret)
 	if err != nil {
 		return "", err
 	}
 
-	fmt.Printf("Token claims added: %+v\n", claims)
+	// never log the token or its claims verbatim
+	slog.Debug("token issued", "sub", username, "jti", tokenID)
 	return tokenString, nil
 }
 
 // checks if JWT is valid
-func verifyToken(tokenString string) (*jwt.Token, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
+func (a *Authenticator) verifyToken(tokenString string) (*jwt.Token, error) {
+	// only HS256 is ever issued, so no other algorithm is accepted
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return a.secret, nil
 	})
 
 	if err != nil {
@@ -44,28 +89,74 @@ func verifyToken(tokenString string) (*jwt.Token, error) {
 		return nil, fmt.Errorf("invalid token")
 	}
 
+	if claims, ok := token.Claims.(jwt.MapClaims); !ok || !claims.VerifyIssuer(issuer, true) {
+		return nil, fmt.Errorf("token not issued by %s", issuer)
+	}
+
 	return token, nil
 }
 
+// builds a principal from verified token claims
+func principalFromClaims(claims jwt.MapClaims) (*Principal, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	p := &Principal{Subject: subject, Roles: []string{}, AuthMethod: MethodJWTCookie}
+	p.TokenID, _ = claims["jti"].(string)
+
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, r := range roles {
+			if role, ok := r.(string); ok {
+				p.Roles = append(p.Roles, role)
+			}
+		}
+	}
+
+	return p, nil
+}
+
 // verifies JWT token
-func AuthenticateMiddleware(c *gin.Context) {
+func (a *Authenticator) AuthenticateMiddleware(c *gin.Context) {
+	// a verified client certificate identifies a partner bank over mTLS
+	if cert := VerifiedClientCert(c.Request); cert != nil {
+		principal, err := a.principalFromCert(cert)
+		if err != nil {
+			problem.Abort(c, http.StatusUnauthorized, problem.CodeUnknownClientCert, "The client certificate is not mapped to a principal")
+			return
+		}
+		SetPrincipal(c, principal)
+		c.Next()
+		return
+	}
+
 	// cookie expected to contain JWT token
 	tokenString, err := c.Cookie("token")
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		c.Abort()
+		problem.Abort(c, http.StatusUnauthorized, problem.CodeAuthenticationRequired, "Log in to access this resource")
 		return
 	}
 
 	// if token exists, call validation function
-	token, err := verifyToken(tokenString)
+	token, err := a.verifyToken(tokenString)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-		c.Abort()
+		problem.Abort(c, http.StatusUnauthorized, problem.CodeInvalidToken, "The login token is invalid or expired")
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		problem.Abort(c, http.StatusUnauthorized, problem.CodeInvalidToken, "The login token is invalid or expired")
 		return
 	}
 
-	fmt.Printf("Token verified successfully. Claims: %+v\n", token.Claims)
+	principal, err := principalFromClaims(claims)
+	if err != nil {
+		problem.Abort(c, http.StatusUnauthorized, problem.CodeInvalidToken, "The login token is invalid or expired")
+		return
+	}
 
+	SetPrincipal(c, principal)
 	c.Next()
 }
@@ -1,20 +1,44 @@
 package auth
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"pillar-bank/problem"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
 )
 
+// testSecret signs every token in these tests
+var testSecret = []byte("test-secret-0123456789abcdef0123456789")
+
+var testAuth = NewAuthenticator(testSecret, 15*time.Minute)
+
 func TestCreateToken(t *testing.T) {
-	token, err := CreateToken("testuser")
+	token, err := testAuth.CreateToken("testuser")
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
+
+	// expiry follows the configured TTL
+	short := NewAuthenticator(testSecret, time.Minute)
+	token, err = short.CreateToken("testuser")
+	assert.NoError(t, err)
+	parsed, err := short.verifyToken(token)
+	assert.NoError(t, err)
+	exp := parsed.Claims.(jwt.MapClaims)["exp"].(float64)
+	assert.InDelta(t, time.Now().Add(time.Minute).Unix(), exp, 5)
+
+	// tokens signed with another secret are rejected
+	_, err = NewAuthenticator([]byte("another-secret-0123456789abcdef01234"), time.Minute).verifyToken(token)
+	assert.Error(t, err)
 }
 
 // tests AuthenticateMiddleware with valid and invalid tokens
@@ -22,20 +46,21 @@ func TestAuthenticateMiddleware(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
 
-	router.GET("/test", AuthenticateMiddleware, func(c *gin.Context) {
+	router.GET("/test", testAuth.AuthenticateMiddleware, func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "Authenticated"})
 	})
 
 	tests := []struct {
-		name         string
-		setupCookie  func() *http.Cookie
-		expectedCode int
-		expectedBody string
+		name          string
+		setupCookie   func() *http.Cookie
+		expectedCode  int
+		expectedBody  string
+		expectedError string
 	}{
 		{
 			name: "Valid token",
 			setupCookie: func() *http.Cookie {
-				token, _ := CreateToken("user1")
+				token, _ := testAuth.CreateToken("user1")
 				return &http.Cookie{Name: "token", Value: token}
 			},
 			expectedCode: http.StatusOK,
@@ -50,11 +75,11 @@ func TestAuthenticateMiddleware(t *testing.T) {
 					"exp": time.Now().Add(-time.Minute).Unix(), // expired 1 minute ago
 					"iat": time.Now().Add(-time.Minute).Unix(),
 				})
-				tokenString, _ := claims.SignedString(secretKey)
+				tokenString, _ := claims.SignedString(testSecret)
 				return &http.Cookie{Name: "token", Value: tokenString}
 			},
-			expectedCode: http.StatusUnauthorized,
-			expectedBody: `{"error":"Invalid token"}`,
+			expectedCode:  http.StatusUnauthorized,
+			expectedError: problem.CodeInvalidToken,
 		},
 		{
 			name: "Invalid signature",
@@ -68,24 +93,68 @@ func TestAuthenticateMiddleware(t *testing.T) {
 				tokenString, _ := claims.SignedString(wrongKey)
 				return &http.Cookie{Name: "token", Value: tokenString}
 			},
-			expectedCode: http.StatusUnauthorized,
-			expectedBody: `{"error":"Invalid token"}`,
+			expectedCode:  http.StatusUnauthorized,
+			expectedError: problem.CodeInvalidToken,
+		},
+		{
+			name: "Wrong issuer",
+			setupCookie: func() *http.Cookie {
+				claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+					"sub": "user1",
+					"iss": "another-bank",
+					"exp": time.Now().Add(time.Minute).Unix(),
+					"iat": time.Now().Unix(),
+				})
+				tokenString, _ := claims.SignedString(testSecret)
+				return &http.Cookie{Name: "token", Value: tokenString}
+			},
+			expectedCode:  http.StatusUnauthorized,
+			expectedError: problem.CodeInvalidToken,
+		},
+		{
+			name: "No issuer",
+			setupCookie: func() *http.Cookie {
+				claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+					"sub": "user1",
+					"exp": time.Now().Add(time.Minute).Unix(),
+					"iat": time.Now().Unix(),
+				})
+				tokenString, _ := claims.SignedString(testSecret)
+				return &http.Cookie{Name: "token", Value: tokenString}
+			},
+			expectedCode:  http.StatusUnauthorized,
+			expectedError: problem.CodeInvalidToken,
+		},
+		{
+			name: "Signing method other than HS256",
+			setupCookie: func() *http.Cookie {
+				claims := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+					"sub": "user1",
+					"iss": "pillar-bank",
+					"exp": time.Now().Add(time.Minute).Unix(),
+					"iat": time.Now().Unix(),
+				})
+				tokenString, _ := claims.SignedString(testSecret)
+				return &http.Cookie{Name: "token", Value: tokenString}
+			},
+			expectedCode:  http.StatusUnauthorized,
+			expectedError: problem.CodeInvalidToken,
 		},
 		{
 			name: "Malformed token",
 			setupCookie: func() *http.Cookie {
 				return &http.Cookie{Name: "token", Value: "malformed-token"}
 			},
-			expectedCode: http.StatusUnauthorized,
-			expectedBody: `{"error":"Invalid token"}`,
+			expectedCode:  http.StatusUnauthorized,
+			expectedError: problem.CodeInvalidToken,
 		},
 		{
 			name: "No token",
 			setupCookie: func() *http.Cookie {
 				return nil
 			},
-			expectedCode: http.StatusUnauthorized,
-			expectedBody: `{"error":"Authentication required"}`,
+			expectedCode:  http.StatusUnauthorized,
+			expectedError: problem.CodeAuthenticationRequired,
 		},
 	}
 
@@ -102,8 +171,115 @@ func TestAuthenticateMiddleware(t *testing.T) {
 			router.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.expectedCode, w.Code)
-			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			if tt.expectedError != "" {
+				assertProblem(t, w, tt.expectedError)
+			} else {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
 		})
 	}
 
 }
+
+// tests that AuthenticateMiddleware exposes the verified principal to handlers
+func TestAuthenticateMiddlewareSetsPrincipal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	var principal *Principal
+	router.GET("/test", testAuth.AuthenticateMiddleware, func(c *gin.Context) {
+		principal, _ = GetPrincipal(c)
+		c.Status(http.StatusOK)
+	})
+
+	token, err := testAuth.CreateToken("user1", "operator")
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/test", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.NotNil(t, principal) {
+		assert.Equal(t, "user1", principal.Subject)
+		assert.Equal(t, []string{"operator"}, principal.Roles)
+		assert.NotEmpty(t, principal.TokenID)
+		assert.Equal(t, MethodJWTCookie, principal.AuthMethod)
+		assert.True(t, principal.HasRole("operator"))
+		assert.False(t, principal.HasRole("auditor"))
+	}
+}
+
+// tests RequireRole against principals with and without the role
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/test", testAuth.AuthenticateMiddleware, RequireRole(RoleAuditor), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Authorized"})
+	})
+
+	tests := []struct {
+		name          string
+		roles         []string
+		expectedCode  int
+		expectedBody  string
+		expectedError string
+	}{
+		{"Has role", []string{RoleOperator, RoleAuditor}, http.StatusOK, `{"message":"Authorized"}`, ""},
+		{"Missing role", []string{RoleOperator}, http.StatusForbidden, "", problem.CodeInsufficientPermission},
+		{"No roles", nil, http.StatusForbidden, "", problem.CodeInsufficientPermission},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _ := testAuth.CreateToken("user1", tt.roles...)
+			req, _ := http.NewRequest("GET", "/test", nil)
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedError != "" {
+				assertProblem(t, w, tt.expectedError)
+			} else {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	supervisor := &Principal{Subject: "user2", Roles: []string{RoleOperator, RoleSupervisor}}
+	operator := &Principal{Subject: "user1", Roles: []string{RoleOperator, RoleAuditor}}
+
+	assert.True(t, supervisor.HasPermission(PermUnmaskAccounts))
+	assert.False(t, operator.HasPermission(PermUnmaskAccounts))
+	assert.False(t, operator.HasPermission("unknown"))
+}
+
+// tests that issuing a token never logs the token or its claims verbatim
+func TestCreateTokenDoesNotLogSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previous)
+
+	token, err := testAuth.CreateToken("user1", RoleOperator)
+	assert.NoError(t, err)
+
+	assert.Contains(t, buf.String(), "token issued")
+	assert.NotContains(t, buf.String(), token)
+	assert.NotContains(t, buf.String(), strings.Split(token, ".")[1], "claims segment should not be logged")
+}
+
+// asserts that the response is a problem with the given code
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, code string) {
+	t.Helper()
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, code, p.Code)
+	assert.Equal(t, w.Code, p.Status)
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"net/http"
+
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authentication methods a principal can be established with
+const (
+	MethodJWTCookie  = "jwt-cookie"
+	MethodClientCert = "client-cert"
+)
+
+// roles granted to principals
+const (
+	RoleOperator   = "operator"
+	RoleAuditor    = "auditor"
+	RoleSupervisor = "supervisor"
+	RoleCompliance = "compliance"
+)
+
+// IsKnownRole checks if role is one of the roles above
+func IsKnownRole(role string) bool {
+	switch role {
+	case RoleOperator, RoleAuditor, RoleSupervisor, RoleCompliance:
+		return true
+	}
+	return false
+}
+
+// permissions that are granted through roles rather than checked by role name
+const (
+	PermUnmaskAccounts = "accounts:unmask"
+)
+
+// rolePermissions lists the permissions each role grants
+var rolePermissions = map[string][]string{
+	RoleSupervisor: {PermUnmaskAccounts},
+}
+
+// key the authenticated principal is stored under in the gin context
+const principalKey = "auth.principal"
+
+// Principal identifies the authenticated caller of a request
+type Principal struct {
+	Subject    string   `json:"subject"`
+	Roles      []string `json:"roles"`
+	TokenID    string   `json:"token_id,omitempty"`
+	AuthMethod string   `json:"auth_method"`
+}
+
+// HasRole reports whether the principal was granted the given role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether any of the principal's roles grants the permission
+func (p *Principal) HasPermission(permission string) bool {
+	for _, role := range p.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetPrincipal stores the authenticated principal on the request context
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalKey, p)
+}
+
+// GetPrincipal returns the authenticated principal, if any
+func GetPrincipal(c *gin.Context) (*Principal, bool) {
+	value, exists := c.Get(principalKey)
+	if !exists {
+		return nil, false
+	}
+	p, ok := value.(*Principal)
+	return p, ok
+}
+
+// Subject returns the authenticated subject, or an empty string for anonymous requests
+func Subject(c *gin.Context) string {
+	if p, ok := GetPrincipal(c); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// RequireRole aborts with 403 unless the authenticated principal has the role.
+// It must run after AuthenticateMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := GetPrincipal(c)
+		if !ok || !p.HasRole(role) {
+			problem.Abort(c, http.StatusForbidden, problem.CodeInsufficientPermission, "Your role does not allow this action")
+			return
+		}
+		c.Next()
+	}
+}
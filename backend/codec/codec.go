@@ -0,0 +1,164 @@
+package codec
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"pillar-bank/models"
+)
+
+// Codec converts wire messages to and from one representation
+type Codec interface {
+	// Name identifies the codec in logs and metrics
+	Name() string
+	// ContentTypes lists the media types the codec reads and writes; the
+	// first is the one responses are labelled with
+	ContentTypes() []string
+	// Decode parses and validates a request body. Validation failures are
+	// reported as wire.Errors.
+	Decode(body []byte) (models.WireMessage, error)
+	// Encode writes one wire
+	Encode(wm models.WireMessage) ([]byte, error)
+	// EncodeList writes a list of wires
+	EncodeList(wms []models.WireMessage) ([]byte, error)
+}
+
+// Registry picks a codec for a request body from its Content-Type and for
+// a response from the Accept header
+type Registry struct {
+	codecs          []Codec
+	byType          map[string]Codec
+	responseDefault string
+}
+
+// NewRegistry creates an empty registry. Responses to clients that accept
+// any media type use the codec registered for responseDefault.
+func NewRegistry(responseDefault string) *Registry {
+	return &Registry{byType: map[string]Codec{}, responseDefault: responseDefault}
+}
+
+// Default returns the registry the API serves: the wire string format,
+// which bodies without a Content-Type are read as, then JSON, which
+// responses default to
+func Default() *Registry {
+	r := NewRegistry(JSONContentType)
+	for _, c := range []Codec{Text{}, JSON{}} {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds c, failing if one of its media types is already taken
+func (r *Registry) Register(c Codec) error {
+	for _, contentType := range c.ContentTypes() {
+		if existing, ok := r.byType[contentType]; ok {
+			return fmt.Errorf("codec %s: %s is already registered by %s", c.Name(), contentType, existing.Name())
+		}
+	}
+	for _, contentType := range c.ContentTypes() {
+		r.byType[contentType] = c
+	}
+	r.codecs = append(r.codecs, c)
+	return nil
+}
+
+// ContentTypes lists every registered media type in registration order
+func (r *Registry) ContentTypes() []string {
+	var types []string
+	for _, c := range r.codecs {
+		types = append(types, c.ContentTypes()...)
+	}
+	return types
+}
+
+// ForContentType returns the codec for a request's Content-Type header.
+// Bodies without one are read by the first registered codec.
+func (r *Registry) ForContentType(header string) (Codec, bool) {
+	if strings.TrimSpace(header) == "" {
+		if len(r.codecs) == 0 {
+			return nil, false
+		}
+		return r.codecs[0], true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, false
+	}
+	c, ok := r.byType[mediaType]
+	return c, ok
+}
+
+// levels of specificity of an Accept entry; more specific entries win ties
+const (
+	anyType = iota // */*
+	subtype        // text/*
+	exact          // text/plain
+)
+
+// Negotiate returns the codec for a response given the request's Accept
+// header, preferring higher quality values and then more specific entries.
+// A missing header accepts anything. ok is false when nothing the client
+// accepts is registered.
+func (r *Registry) Negotiate(accept string) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	var best Codec
+	bestQ, bestLevel := 0.0, -1
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		// q=0 means not acceptable
+		if q <= 0 {
+			continue
+		}
+
+		c, level := r.match(mediaType)
+		if c == nil {
+			continue
+		}
+		if q > bestQ || q == bestQ && level > bestLevel {
+			best, bestQ, bestLevel = c, q, level
+		}
+	}
+
+	return best, best != nil
+}
+
+// returns the codec for one Accept media range and how specific it was
+func (r *Registry) match(mediaType string) (Codec, int) {
+	if mediaType == "*/*" {
+		return r.byType[r.responseDefault], anyType
+	}
+
+	if prefix, ok := strings.CutSuffix(mediaType, "*"); ok {
+		if strings.HasPrefix(r.responseDefault, prefix) {
+			return r.byType[r.responseDefault], subtype
+		}
+		for _, c := range r.codecs {
+			for _, contentType := range c.ContentTypes() {
+				if strings.HasPrefix(contentType, prefix) {
+					return c, subtype
+				}
+			}
+		}
+		return nil, subtype
+	}
+
+	return r.byType[mediaType], exact
+}
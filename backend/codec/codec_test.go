@@ -0,0 +1,255 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"pillar-bank/models"
+	"pillar-bank/testdata"
+	"pillar-bank/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	r := Default()
+
+	tests := []struct {
+		accept   string
+		expected string // codec name, empty when nothing is acceptable
+	}{
+		{"", "json"},
+		{"*/*", "json"},
+		{"application/json", "json"},
+		{"text/plain", "wire"},
+		{"text/plain; charset=utf-8", "wire"},
+		{"text/*", "wire"},
+		{"application/*", "json"},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", "json"},
+		{"application/json;q=0.5, text/plain", "wire"},
+		{"*/*, text/plain", "wire"},
+		{"text/plain;q=0, */*", "json"},
+		{"application/xml", ""},
+		{"text/plain;q=0", ""},
+		{"not a media type", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			c, ok := r.Negotiate(tt.accept)
+			if tt.expected == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, tt.expected, c.Name())
+		})
+	}
+}
+
+func TestForContentType(t *testing.T) {
+	r := Default()
+
+	tests := []struct {
+		contentType string
+		expected    string
+	}{
+		// bodies without a type have always been read as the wire string format
+		{"", "wire"},
+		{"text/plain", "wire"},
+		{"text/plain; charset=utf-8", "wire"},
+		{"Application/JSON", "json"},
+		{"application/xml", ""},
+		{"application/x-www-form-urlencoded", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			c, ok := r.ForContentType(tt.contentType)
+			if tt.expected == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, tt.expected, c.Name())
+		})
+	}
+}
+
+func TestRegisterRejectsTakenType(t *testing.T) {
+	r := NewRegistry(JSONContentType)
+	require.NoError(t, r.Register(JSON{}))
+	assert.Error(t, r.Register(JSON{}))
+	assert.Equal(t, []string{JSONContentType}, r.ContentTypes())
+}
+
+// tests that the wire string codec reads back what it writes
+func TestTextRoundTrip(t *testing.T) {
+	for _, tt := range testdata.ValidMessages {
+		t.Run(tt.Name, func(t *testing.T) {
+			body, err := Text{}.Encode(tt.Expected)
+			require.NoError(t, err)
+
+			wm, err := Text{}.Decode(body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Expected.Seq, wm.Seq)
+			assert.Equal(t, tt.Expected.SenderAN, wm.SenderAN)
+			assert.Equal(t, tt.Expected.ReceiverAN, wm.ReceiverAN)
+			assert.Equal(t, tt.Expected.Amount, wm.Amount)
+			assert.Equal(t, tt.WireMessage, wm.CanonicalMessage)
+		})
+	}
+}
+
+func TestEncodeList(t *testing.T) {
+	wms := []models.WireMessage{testdata.ValidMessages[0].Expected, testdata.ValidMessages[1].Expected}
+
+	body, err := Text{}.EncodeList(wms)
+	require.NoError(t, err)
+	assert.Equal(t, testdata.ValidMessages[0].WireMessage+"\n"+testdata.ValidMessages[1].WireMessage+"\n", string(body))
+
+	body, err = JSON{}.EncodeList(wms)
+	require.NoError(t, err)
+	var decoded []models.WireMessage
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Len(t, decoded, 2)
+
+	body, err = JSON{}.EncodeList(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(body))
+}
+
+func TestJSONDecode(t *testing.T) {
+	for _, tt := range testdata.ValidMessages {
+		t.Run(tt.Name, func(t *testing.T) {
+			wm, err := JSON{}.Decode(jsonBody(tt.Expected))
+			require.NoError(t, err)
+			assert.Equal(t, tt.Expected.Seq, wm.Seq)
+			assert.Equal(t, tt.Expected.SenderRTN, wm.SenderRTN)
+			assert.Equal(t, tt.Expected.SenderAN, wm.SenderAN)
+			assert.Equal(t, tt.Expected.ReceiverAN, wm.ReceiverAN)
+			assert.Equal(t, tt.Expected.Amount, wm.Amount)
+			// the raw message is synthesized in canonical form
+			assert.Equal(t, tt.WireMessage, wm.RawMessage)
+			assert.Equal(t, tt.WireMessage, wm.CanonicalMessage)
+		})
+	}
+}
+
+func TestJSONDecodeExtendedFields(t *testing.T) {
+	body := `{"seq": 1, "sender_rtn": "021000021", "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": 1000,
+		"type_subtype": "1000", "business_function_code": "CTR", "beneficiary_name": "Jane Doe", "remittance_info": "Invoice 42; 43"}`
+
+	wm, err := JSON{}.Decode([]byte(body))
+	require.NoError(t, err)
+	assert.Equal(t, "1000", wm.TypeSubtype)
+	assert.Equal(t, "CTR", wm.BusinessFunctionCode)
+	assert.Equal(t, "Jane Doe", wm.BeneficiaryName)
+	assert.Equal(t, "Invoice 42; 43", wm.RemittanceInfo)
+	assert.Equal(t, "seq=1;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000"+
+		`;type_subtype=1000;business_function_code=CTR;beneficiary_name=Jane Doe;remittance_info=Invoice 42\; 43`, wm.CanonicalMessage)
+}
+
+// builds a request body with the writable fields of wm
+func jsonBody(wm models.WireMessage) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"seq":          wm.Seq,
+		"sender_rtn":   wm.SenderRTN,
+		"sender_an":    wm.SenderAN,
+		"receiver_rtn": wm.ReceiverRTN,
+		"receiver_an":  wm.ReceiverAN,
+		"amount":       wm.Amount,
+	})
+	return body
+}
+
+// tests that a JSON wire is held to the same rules as the wire string
+// format, and that every violation is reported at once
+func TestJSONDecodeErrors(t *testing.T) {
+	const valid = `"seq": 1, "sender_rtn": "021000021", "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": 1000`
+
+	tests := []struct {
+		name     string
+		body     string
+		expected []string // field:reason
+	}{
+		{"Not JSON", `seq=1`, []string{":invalid_format"}},
+		{"Not an object", `[1, 2]`, []string{":invalid_format"}},
+		{"Trailing data", `{` + valid + `} {}`, []string{":invalid_format"}},
+		{"Unknown field", `{` + valid + `, "memo": "x"}`, []string{"memo:unknown_field"}},
+		{"Read-only field", `{` + valid + `, "created_by": "mallory"}`, []string{"created_by:unknown_field"}},
+		{"Duplicate field", `{` + valid + `, "amount": 5}`, []string{"amount:duplicate_field"}},
+		{"Missing fields", `{"seq": 1, "sender_rtn": "021000021"}`, []string{
+			"sender_an:missing_field", "receiver_rtn:missing_field", "receiver_an:missing_field", "amount:missing_field",
+		}},
+		{"Null value", `{"seq": null, "sender_rtn": "021000021", "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": 1000}`, []string{"seq:empty_value"}},
+		{"Quoted number", `{"seq": "1", "sender_rtn": "021000021", "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": 1000}`, []string{"seq:invalid_seq"}},
+		{"Numeric routing number", `{"seq": 1, "sender_rtn": 21000021, "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": 1000}`, []string{"sender_rtn:invalid_rtn"}},
+		{"Fractional amount", `{"seq": 1, "sender_rtn": "021000021", "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": 10.5}`, []string{"amount:invalid_amount"}},
+		{"Negative amount", `{"seq": 1, "sender_rtn": "021000021", "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": -5}`, []string{"amount:invalid_amount"}},
+		{"Numeric name", `{` + valid + `, "beneficiary_name": 42}`, []string{"beneficiary_name:invalid_characters"}},
+		{"Long reference", `{` + valid + `, "beneficiary_reference": "REF-0000000000001"}`, []string{"beneficiary_reference:value_too_long"}},
+		{"Every error at once", `{"seq": "x", "sender_rtn": "1234", "memo": "x", "amount": 1, "amount": 2}`, []string{
+			"seq:invalid_seq", "memo:unknown_field", "amount:duplicate_field",
+			"sender_rtn:invalid_rtn", "sender_an:missing_field", "receiver_rtn:missing_field", "receiver_an:missing_field",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := JSON{}.Decode([]byte(tt.body))
+			var errs wire.Errors
+			require.True(t, errors.As(err, &errs), "expected wire.Errors, got %v", err)
+
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Field+":"+e.Reason)
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+// tests that echoing a response back names the fields the server sets
+func TestJSONDecodeServerFields(t *testing.T) {
+	const valid = `"seq": 1, "sender_rtn": "021000021", "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": 1000`
+
+	for _, field := range []string{"id", "message", "canonical_message", "created_by", "created_at",
+		"status", "screening_hits", "risk_score", "rule_hits", "duplicate_of", "namespace"} {
+		t.Run(field, func(t *testing.T) {
+			_, err := JSON{}.Decode([]byte(`{` + valid + `, "` + field + `": null}`))
+			var errs wire.Errors
+			require.True(t, errors.As(err, &errs), "expected wire.Errors, got %v", err)
+			require.Len(t, errs, 1)
+			assert.Equal(t, field, errs[0].Field)
+			assert.Contains(t, errs[0].Message, "is set by the server")
+		})
+	}
+}
+
+// FuzzJSONDecode checks that decoding never panics and that every wire it
+// accepts is valid in the wire string format too
+func FuzzJSONDecode(f *testing.F) {
+	for _, tt := range testdata.ValidMessages {
+		f.Add(jsonBody(tt.Expected))
+	}
+	f.Add([]byte(`{"seq": 1e3, "amount": -0, "sender_rtn": null}`))
+	f.Add([]byte(`{"seq": 99999999999999999999}`))
+	f.Add([]byte(`[{}]`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		wm, err := JSON{}.Decode(body)
+		if err != nil {
+			var errs wire.Errors
+			require.True(t, errors.As(err, &errs))
+			require.NotEmpty(t, errs)
+			return
+		}
+
+		parsed, err := wire.Parse(wm.CanonicalMessage)
+		require.NoError(t, err)
+		require.Equal(t, wm.CanonicalMessage, parsed.CanonicalMessage)
+	})
+}
@@ -0,0 +1,219 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"pillar-bank/models"
+	"pillar-bank/wire"
+)
+
+// JSONContentType is the media type of the JSON representation
+const JSONContentType = "application/json"
+
+// JSON reads and writes wires in the models.WireMessage JSON shape
+type JSON struct{}
+
+// Name implements Codec
+func (JSON) Name() string { return "json" }
+
+// ContentTypes implements Codec
+func (JSON) ContentTypes() []string { return []string{JSONContentType} }
+
+// writable fields, in the order they are handed to the wire parser
+var jsonFields = []string{
+	"seq", "sender_rtn", "sender_an", "receiver_rtn", "receiver_an", "amount",
+	"type_subtype", "business_function_code",
+	"beneficiary_name", "beneficiary_address", "beneficiary_reference",
+	"originator_name", "originator_address", "remittance_info",
+}
+
+// fields that take JSON numbers; routing and account numbers are strings so
+// leading zeros survive
+var numberFields = map[string]bool{"seq": true, "amount": true}
+
+// reason reported when a writable field holds the wrong kind of JSON value
+var typeReason = map[string]string{
+	"seq":          wire.ReasonInvalidSeq,
+	"sender_rtn":   wire.ReasonInvalidRTN,
+	"sender_an":    wire.ReasonInvalidAccount,
+	"receiver_rtn": wire.ReasonInvalidRTN,
+	"receiver_an":  wire.ReasonInvalidAccount,
+	"amount":       wire.ReasonInvalidAmount,
+
+	"type_subtype":           wire.ReasonInvalidTypeSubtype,
+	"business_function_code": wire.ReasonInvalidBusinessFunction,
+	"beneficiary_name":       wire.ReasonInvalidCharacters,
+	"beneficiary_address":    wire.ReasonInvalidCharacters,
+	"beneficiary_reference":  wire.ReasonInvalidCharacters,
+	"originator_name":        wire.ReasonInvalidCharacters,
+	"originator_address":     wire.ReasonInvalidCharacters,
+	"remittance_info":        wire.ReasonInvalidCharacters,
+}
+
+// fields of the response shape that only the server sets
+var readOnlyFields = map[string]bool{
+	"id":                true,
+	"message":           true,
+	"canonical_message": true,
+	"created_by":        true,
+	"created_at":        true,
+	"status":            true,
+	"screening_hits":    true,
+	"risk_score":        true,
+	"rule_hits":         true,
+	"duplicate_of":      true,
+	"namespace":         true,
+}
+
+// Decode reads a JSON object with the writable fields of models.WireMessage.
+// Unknown, read-only, repeated and mistyped fields are reported together
+// with every violation of the wire string rules, which the values are then
+// checked against. The raw message stored for the wire is its canonical
+// form.
+func (JSON) Decode(body []byte) (models.WireMessage, error) {
+	values, errs := readJSONFields(body)
+	if values == nil {
+		return models.WireMessage{}, errs
+	}
+
+	// the values are checked by the wire parser, so both formats obey the
+	// same rules; fields are handed over in order and only when present so
+	// missing ones are reported as such
+	var parts []string
+	for _, field := range jsonFields {
+		if value, ok := values[field]; ok {
+			parts = append(parts, field+"="+wire.Escape(value))
+		}
+	}
+
+	wm, err := wire.Parse(strings.Join(parts, ";"))
+	var parseErrs wire.Errors
+	if errors.As(err, &parseErrs) {
+		for _, parseErr := range parseErrs {
+			// a mistyped field was present, it is not also missing
+			if parseErr.Reason == wire.ReasonMissingField && reported(errs, parseErr.Field) {
+				continue
+			}
+			errs = append(errs, parseErr)
+		}
+	}
+	if len(errs) > 0 {
+		return models.WireMessage{}, errs
+	}
+
+	wm.RawMessage = wm.CanonicalMessage
+	return wm, nil
+}
+
+// reads the top-level object of body, returning the writable fields as wire
+// string values. values is nil when body is not a JSON object at all.
+func readJSONFields(body []byte) (map[string]string, wire.Errors) {
+	invalid := func(msg string) wire.Errors {
+		return wire.Errors{{Reason: wire.ReasonInvalidFormat, Message: "invalid JSON body: " + msg}}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, invalid("must be an object")
+	}
+
+	values := map[string]string{}
+	seen := map[string]bool{}
+	var errs wire.Errors
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, invalid("malformed object")
+		}
+		key := tok.(string)
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, invalid("malformed object")
+		}
+
+		_, known := typeReason[key]
+		switch {
+		case readOnlyFields[key]:
+			errs = append(errs, &wire.Error{Field: key, Reason: wire.ReasonUnknownField, Message: fmt.Sprintf("unknown field: %q is set by the server", key)})
+			continue
+		case !known:
+			errs = append(errs, &wire.Error{Field: key, Reason: wire.ReasonUnknownField, Message: fmt.Sprintf("unknown field: %q is not a wire message field", key)})
+			continue
+		case seen[key]:
+			errs = append(errs, &wire.Error{Field: key, Reason: wire.ReasonDuplicateField, Message: fmt.Sprintf("duplicate field: %s appears more than once", key)})
+			continue
+		}
+		seen[key] = true
+
+		value, err := jsonValue(raw, numberFields[key])
+		if err != nil {
+			errs = append(errs, &wire.Error{Field: key, Reason: typeReason[key], Message: fmt.Sprintf("invalid %s: %s", key, err)})
+			continue
+		}
+		values[key] = value
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, invalid("malformed object")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, invalid("unexpected data after the object")
+	}
+
+	return values, errs
+}
+
+// checks if errs already has a violation for field
+func reported(errs wire.Errors, field string) bool {
+	for _, err := range errs {
+		if err.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// converts a JSON value to its wire string form. null becomes an empty
+// value, which the wire rules reject.
+func jsonValue(raw json.RawMessage, isNumber bool) (string, error) {
+	if string(raw) == "null" {
+		return "", nil
+	}
+
+	if isNumber {
+		// json.Number would also take a quoted number
+		var n json.Number
+		if raw[0] == '"' || json.Unmarshal(raw, &n) != nil {
+			return "", errors.New("must be a number")
+		}
+		// fractions, exponents and signs are left for the wire rules to reject
+		return n.String(), nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", errors.New("must be a string")
+	}
+	return s, nil
+}
+
+// Encode writes wm indented, as the API always has
+func (JSON) Encode(wm models.WireMessage) ([]byte, error) {
+	return json.MarshalIndent(wm, "", "    ")
+}
+
+// EncodeList writes wms as an indented array
+func (JSON) EncodeList(wms []models.WireMessage) ([]byte, error) {
+	if wms == nil {
+		wms = []models.WireMessage{}
+	}
+	return json.MarshalIndent(wms, "", "    ")
+}
@@ -0,0 +1,40 @@
+package codec
+
+import (
+	"strings"
+
+	"pillar-bank/models"
+	"pillar-bank/wire"
+)
+
+// TextContentType is the media type of the semicolon-delimited wire format
+const TextContentType = "text/plain"
+
+// Text reads and writes the key=value wire string format
+type Text struct{}
+
+// Name implements Codec
+func (Text) Name() string { return "wire" }
+
+// ContentTypes implements Codec
+func (Text) ContentTypes() []string { return []string{TextContentType} }
+
+// Decode implements Codec
+func (Text) Decode(body []byte) (models.WireMessage, error) {
+	return wire.Parse(string(body))
+}
+
+// Encode writes wm in canonical form on one line
+func (Text) Encode(wm models.WireMessage) ([]byte, error) {
+	return []byte(wire.Format(wm) + "\n"), nil
+}
+
+// EncodeList writes one wire per line
+func (Text) EncodeList(wms []models.WireMessage) ([]byte, error) {
+	var b strings.Builder
+	for _, wm := range wms {
+		b.WriteString(wire.Format(wm))
+		b.WriteByte('\n')
+	}
+	return []byte(b.String()), nil
+}
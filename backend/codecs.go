@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"pillar-bank/codec"
+	"pillar-bank/models"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// picks the codec for the response from the Accept header. Clients that
+// accept none of the registered types get a 406 and ok is false, in which
+// case the handler must stop.
+func (h *Handler) responseCodec(c *gin.Context) (codec.Codec, bool) {
+	c.Writer.Header().Add("Vary", "Accept")
+
+	cd, ok := h.codecs.Negotiate(c.GetHeader("Accept"))
+	if !ok {
+		handleError(c, http.StatusNotAcceptable, problem.CodeNotAcceptable,
+			fmt.Sprintf("Wire messages are available as %s", strings.Join(h.codecs.ContentTypes(), ", ")))
+	}
+	return cd, ok
+}
+
+// picks the codec for the request body from its Content-Type. Unknown
+// types get a 415 and ok is false, in which case the handler must stop.
+func (h *Handler) requestCodec(c *gin.Context) (codec.Codec, bool) {
+	cd, ok := h.codecs.ForContentType(c.ContentType())
+	if !ok {
+		handleError(c, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType,
+			fmt.Sprintf("Wire messages can be sent as %s", strings.Join(h.codecs.ContentTypes(), ", ")))
+	}
+	return cd, ok
+}
+
+// writes wm with the negotiated codec
+func renderWire(c *gin.Context, status int, cd codec.Codec, wm models.WireMessage) {
+	body, err := cd.Encode(wm)
+	render(c, status, cd, body, err)
+}
+
+// writes wms with the negotiated codec
+func renderWires(c *gin.Context, status int, cd codec.Codec, wms []models.WireMessage) {
+	body, err := cd.EncodeList(wms)
+	render(c, status, cd, body, err)
+}
+
+func render(c *gin.Context, status int, cd codec.Codec, body []byte, err error) {
+	if err != nil {
+		problem.Internal(c, "failed to encode response", err)
+		return
+	}
+	c.Data(status, cd.ContentTypes()[0]+"; charset=utf-8", body)
+}
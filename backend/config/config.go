@@ -0,0 +1,671 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pillar-bank/auth"
+	"pillar-bank/cors"
+	"pillar-bank/logging"
+	"pillar-bank/ratelimit"
+	"pillar-bank/tlsconfig"
+	"pillar-bank/tracing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// minimum length of the JWT signing secret
+const minSecretLength = 32
+
+// Config holds every setting the backend reads at startup. Values are
+// layered, each source overriding the one before: defaults, the YAML file
+// named by -config or CONFIG_FILE, environment variables, then flags.
+type Config struct {
+	Addr          string     `yaml:"addr"`
+	LogLevel      string     `yaml:"log_level"`
+	MasterKeyFile string     `yaml:"master_key_file"`
+	MaxBodyBytes  int64      `yaml:"max_body_bytes"`
+	Database      Database   `yaml:"database"`
+	CORS          CORS       `yaml:"cors"`
+	TLS           TLS        `yaml:"tls"`
+	RateLimit     RateLimit  `yaml:"rate_limit"`
+	Auth          Auth       `yaml:"auth"`
+	Tracing       Tracing    `yaml:"tracing"`
+	Sanctions     Sanctions  `yaml:"sanctions"`
+	Rules         Rules      `yaml:"rules"`
+	Duplicates    Duplicates `yaml:"duplicates"`
+	Sequences     Sequences  `yaml:"sequences"`
+}
+
+// Database locates the Postgres server
+type Database struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+}
+
+// CORS controls which browser origins may call the API and how
+type CORS struct {
+	AllowedOrigins []string      `yaml:"allowed_origins"`
+	AllowedMethods []string      `yaml:"allowed_methods"`
+	AllowedHeaders []string      `yaml:"allowed_headers"`
+	ExposedHeaders []string      `yaml:"exposed_headers"`
+	MaxAge         time.Duration `yaml:"max_age"`
+}
+
+// TLS enables HTTPS when a certificate and key are set, and mTLS when a
+// client CA is set as well
+type TLS struct {
+	CertFile       string        `yaml:"cert_file"`
+	KeyFile        string        `yaml:"key_file"`
+	ClientCAFile   string        `yaml:"client_ca_file"`
+	ClientAuth     string        `yaml:"client_auth"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// Enabled checks if the server should terminate TLS itself
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// RateLimit sets a token bucket per client for each route group
+type RateLimit struct {
+	Enabled bool                      `yaml:"enabled"`
+	Store   string                    `yaml:"store"`
+	Groups  map[string]RateLimitGroup `yaml:"groups"`
+}
+
+// RateLimitGroup is the sustained rate and burst allowed for a route group
+type RateLimitGroup struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
+}
+
+// rate limiter stores
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+// Limits converts the groups for the ratelimit package
+func (r RateLimit) Limits() map[string]ratelimit.Limit {
+	limits := make(map[string]ratelimit.Limit, len(r.Groups))
+	for name, g := range r.Groups {
+		limits[name] = ratelimit.PerMinute(g.RequestsPerMinute, g.Burst)
+	}
+	return limits
+}
+
+// Auth configures login and the token cookie
+type Auth struct {
+	JWTSecret    string        `yaml:"jwt_secret"`
+	TokenTTL     time.Duration `yaml:"token_ttl"`
+	CookieDomain string        `yaml:"cookie_domain"`
+	Users        []User        `yaml:"users"`
+	ClientCerts  []ClientCert  `yaml:"client_certs"`
+}
+
+// ClientCert maps the common name of a partner bank's client certificate to
+// the roles it is granted
+type ClientCert struct {
+	CommonName string   `yaml:"common_name"`
+	Roles      []string `yaml:"roles"`
+}
+
+// User is an account allowed to log in
+type User struct {
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	Roles    []string `yaml:"roles"`
+}
+
+// Tracing selects the span exporter
+type Tracing struct {
+	ServiceName string `yaml:"service_name"`
+	Exporter    string `yaml:"exporter"`
+}
+
+// Sanctions configures screening of wire parties against an OFAC SDN list.
+// Screening is off while no list is configured.
+type Sanctions struct {
+	SDNFile   string  `yaml:"sdn_file"`
+	Threshold float64 `yaml:"threshold"`
+}
+
+// Rules names the file declaring the fraud and velocity rules each wire is
+// scored against. Scoring is off while no file is configured.
+type Rules struct {
+	File string `yaml:"file"`
+}
+
+// Duplicates sets how far back a wire is compared against earlier ones with
+// the same parties and amount; 0 turns the check off
+type Duplicates struct {
+	Window time.Duration `yaml:"window"`
+}
+
+// Sequences controls how wire sequence numbers are checked. Each sender
+// routing number numbers its wires on its own unless it is listed in a
+// channel, whose routing numbers share one sequence. With HoldGaps, a wire
+// that arrives while an earlier seq is missing waits until the gap fills or
+// GapTimeout passes.
+type Sequences struct {
+	Channels   map[string][]string `yaml:"channels"`
+	HoldGaps   bool                `yaml:"hold_gaps"`
+	GapTimeout time.Duration       `yaml:"gap_timeout"`
+}
+
+// longest channel name, the width of the namespace column
+const maxChannelName = 64
+
+// Namespaces maps each routing number listed in a channel to the channel
+func (s Sequences) Namespaces() map[string]string {
+	namespaces := map[string]string{}
+	for channel, rtns := range s.Channels {
+		for _, rtn := range rtns {
+			namespaces[rtn] = channel
+		}
+	}
+	return namespaces
+}
+
+// Default returns the settings used when no source overrides them
+func Default() *Config {
+	return &Config{
+		Addr:          ":8080",
+		LogLevel:      "info",
+		MasterKeyFile: "dev.keyfile",
+		MaxBodyBytes:  16 << 10,
+		Database: Database{
+			Host:    "localhost",
+			Port:    5432,
+			SSLMode: "disable",
+		},
+		CORS: CORS{
+			AllowedOrigins: []string{"http://localhost:3000"},
+			AllowedMethods: []string{http.MethodGet, http.MethodPost},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "Idempotency-Key", "X-Request-ID"},
+			ExposedHeaders: []string{
+				"X-Request-ID", "Retry-After",
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+			},
+			MaxAge: 10 * time.Minute,
+		},
+		TLS: TLS{
+			ClientAuth:     tlsconfig.ClientAuthOptional,
+			ReloadInterval: time.Minute,
+		},
+		RateLimit: RateLimit{
+			Enabled: true,
+			Store:   RateLimitStoreMemory,
+			Groups: map[string]RateLimitGroup{
+				ratelimit.GroupLogin:     {RequestsPerMinute: 10, Burst: 5},
+				ratelimit.GroupWireRead:  {RequestsPerMinute: 300, Burst: 60},
+				ratelimit.GroupWireWrite: {RequestsPerMinute: 120, Burst: 30},
+			},
+		},
+		Auth: Auth{
+			TokenTTL:     15 * time.Minute,
+			CookieDomain: "localhost",
+		},
+		Tracing: Tracing{
+			ServiceName: "pillar-bank",
+			Exporter:    tracing.ExporterNone,
+		},
+		Sanctions: Sanctions{
+			Threshold: 0.9,
+		},
+		Duplicates: Duplicates{
+			Window: 24 * time.Hour,
+		},
+		Sequences: Sequences{
+			GapTimeout: 15 * time.Minute,
+		},
+	}
+}
+
+// Load registers the config flags on fs, parses args and builds the
+// validated configuration
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	configFile := fs.String("config", "", "path to a YAML config file (env CONFIG_FILE)")
+	addr := fs.String("addr", "", "address to listen on (env HTTP_ADDR)")
+	logLevel := fs.String("log-level", "", "debug, info, warn or error (env LOG_LEVEL)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	cfg := Default()
+
+	path := os.Getenv("CONFIG_FILE")
+	if set["config"] {
+		path = *configFile
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if set["addr"] {
+		cfg.Addr = *addr
+	}
+	if set["log-level"] {
+		cfg.LogLevel = *logLevel
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// overlays the settings present in a YAML file
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// overlays the settings present in the environment
+func (cfg *Config) loadEnv() error {
+	var errs []error
+
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	secret := func(name string, dst *string) {
+		v, ok, err := lookupSecret(name)
+		if err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			*dst = v
+		}
+	}
+
+	str("HTTP_ADDR", &cfg.Addr)
+	str("LOG_LEVEL", &cfg.LogLevel)
+	str("MASTER_KEY_FILE", &cfg.MasterKeyFile)
+	if v, ok := os.LookupEnv("MAX_BODY_BYTES"); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("MAX_BODY_BYTES: %q is not a number", v))
+		}
+		cfg.MaxBodyBytes = n
+	}
+
+	str("DB_HOST", &cfg.Database.Host)
+	str("DB_USER", &cfg.Database.User)
+	secret("DB_PASSWORD", &cfg.Database.Password)
+	str("DB_NAME", &cfg.Database.Name)
+	str("DB_SSLMODE", &cfg.Database.SSLMode)
+	if v, ok := os.LookupEnv("DB_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DB_PORT: %q is not a number", v))
+		}
+		cfg.Database.Port = port
+	}
+
+	list := func(name string, dst *[]string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = splitList(v)
+		}
+	}
+	list("CORS_ALLOWED_ORIGINS", &cfg.CORS.AllowedOrigins)
+	list("CORS_ALLOWED_METHODS", &cfg.CORS.AllowedMethods)
+	list("CORS_ALLOWED_HEADERS", &cfg.CORS.AllowedHeaders)
+	list("CORS_EXPOSED_HEADERS", &cfg.CORS.ExposedHeaders)
+	if v, ok := os.LookupEnv("CORS_MAX_AGE"); ok {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CORS_MAX_AGE: %q is not a duration", v))
+		}
+		cfg.CORS.MaxAge = maxAge
+	}
+
+	str("TLS_CERT_FILE", &cfg.TLS.CertFile)
+	str("TLS_KEY_FILE", &cfg.TLS.KeyFile)
+	str("TLS_CLIENT_CA_FILE", &cfg.TLS.ClientCAFile)
+	str("TLS_CLIENT_AUTH", &cfg.TLS.ClientAuth)
+
+	if v, ok := os.LookupEnv("RATE_LIMIT_ENABLED"); ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("RATE_LIMIT_ENABLED: %q is not a boolean", v))
+		}
+		cfg.RateLimit.Enabled = enabled
+	}
+	str("RATE_LIMIT_STORE", &cfg.RateLimit.Store)
+
+	secret("JWT_SECRET", &cfg.Auth.JWTSecret)
+	str("COOKIE_DOMAIN", &cfg.Auth.CookieDomain)
+	if v, ok := os.LookupEnv("TOKEN_TTL"); ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TOKEN_TTL: %q is not a duration", v))
+		}
+		cfg.Auth.TokenTTL = ttl
+	}
+
+	str("OTEL_SERVICE_NAME", &cfg.Tracing.ServiceName)
+	str("OTEL_TRACES_EXPORTER", &cfg.Tracing.Exporter)
+
+	str("SANCTIONS_SDN_FILE", &cfg.Sanctions.SDNFile)
+	if v, ok := os.LookupEnv("SANCTIONS_THRESHOLD"); ok {
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SANCTIONS_THRESHOLD: %q is not a number", v))
+		}
+		cfg.Sanctions.Threshold = threshold
+	}
+
+	str("RULES_FILE", &cfg.Rules.File)
+
+	if v, ok := os.LookupEnv("DUPLICATE_WINDOW"); ok {
+		window, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DUPLICATE_WINDOW: %q is not a duration", v))
+		}
+		cfg.Duplicates.Window = window
+	}
+
+	if v, ok := os.LookupEnv("SEQUENCE_HOLD_GAPS"); ok {
+		hold, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SEQUENCE_HOLD_GAPS: %q is not a boolean", v))
+		}
+		cfg.Sequences.HoldGaps = hold
+	}
+	if v, ok := os.LookupEnv("SEQUENCE_GAP_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SEQUENCE_GAP_TIMEOUT: %q is not a duration", v))
+		}
+		cfg.Sequences.GapTimeout = timeout
+	}
+
+	return errors.Join(errs...)
+}
+
+// reads a secret from name, or from the file named by name_FILE as used by
+// Docker secrets; setting both is an error
+func lookupSecret(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	path, fromFile := os.LookupEnv(name + "_FILE")
+	if ok && fromFile {
+		return "", false, fmt.Errorf("%s and %s_FILE are both set", name, name)
+	}
+	if !fromFile {
+		return value, ok, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// splits a comma separated list, dropping blanks
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate reports every invalid setting at once
+func (cfg *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		fail("addr: %q is not a host:port address", cfg.Addr)
+	}
+	if _, err := logging.ParseLevel(cfg.LogLevel); err != nil {
+		fail("log_level: %v", err)
+	}
+	if cfg.MasterKeyFile == "" {
+		fail("master_key_file: required")
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		fail("max_body_bytes: must be positive")
+	}
+
+	db := cfg.Database
+	if db.Host == "" {
+		fail("database.host: required")
+	}
+	if db.Port < 1 || db.Port > 65535 {
+		fail("database.port: %d is out of range", db.Port)
+	}
+	if db.User == "" {
+		fail("database.user: required")
+	}
+	if db.Name == "" {
+		fail("database.name: required")
+	}
+	switch db.SSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		fail("database.sslmode: %q must be disable, require, verify-ca or verify-full", db.SSLMode)
+	}
+
+	if len(cfg.CORS.AllowedOrigins) == 0 {
+		fail("cors.allowed_origins: at least one origin is required")
+	}
+	if _, err := cors.New(cfg.CORS.Options()); err != nil {
+		fail("cors: %v", err)
+	}
+
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		fail("tls: cert_file and key_file must be set together")
+	}
+	if cfg.TLS.ClientCAFile != "" && !cfg.TLS.Enabled() {
+		fail("tls.client_ca_file: requires cert_file and key_file")
+	}
+	switch cfg.TLS.ClientAuth {
+	case tlsconfig.ClientAuthOptional, tlsconfig.ClientAuthRequire:
+	default:
+		fail("tls.client_auth: %q must be optional or require", cfg.TLS.ClientAuth)
+	}
+	if cfg.TLS.ReloadInterval <= 0 {
+		fail("tls.reload_interval: must be positive")
+	}
+
+	switch cfg.RateLimit.Store {
+	case RateLimitStoreMemory, RateLimitStorePostgres:
+	default:
+		fail("rate_limit.store: %q must be memory or postgres", cfg.RateLimit.Store)
+	}
+	for name, g := range cfg.RateLimit.Groups {
+		switch name {
+		case ratelimit.GroupLogin, ratelimit.GroupWireRead, ratelimit.GroupWireWrite:
+		default:
+			fail("rate_limit.groups: unknown group %q", name)
+		}
+		if g.RequestsPerMinute < 1 || g.Burst < 1 {
+			fail("rate_limit.groups.%s: requests_per_minute and burst must be at least 1", name)
+		}
+	}
+
+	if len(cfg.Auth.JWTSecret) < minSecretLength {
+		fail("auth.jwt_secret: must be at least %d bytes", minSecretLength)
+	}
+	if cfg.Auth.TokenTTL <= 0 {
+		fail("auth.token_ttl: must be positive")
+	}
+	seen := map[string]bool{}
+	for i, u := range cfg.Auth.Users {
+		if u.Username == "" {
+			fail("auth.users[%d]: username required", i)
+		} else if seen[u.Username] {
+			fail("auth.users[%d]: duplicate username %q", i, u.Username)
+		}
+		seen[u.Username] = true
+		if u.Password == "" {
+			fail("auth.users[%d]: password required", i)
+		}
+		for _, role := range u.Roles {
+			if !auth.IsKnownRole(role) {
+				fail("auth.users[%d]: unknown role %q", i, role)
+			}
+		}
+	}
+
+	certNames := map[string]bool{}
+	for i, cc := range cfg.Auth.ClientCerts {
+		if cc.CommonName == "" {
+			fail("auth.client_certs[%d]: common_name required", i)
+		} else if certNames[cc.CommonName] {
+			fail("auth.client_certs[%d]: duplicate common_name %q", i, cc.CommonName)
+		}
+		certNames[cc.CommonName] = true
+		for _, role := range cc.Roles {
+			if !auth.IsKnownRole(role) {
+				fail("auth.client_certs[%d]: unknown role %q", i, role)
+			}
+		}
+	}
+	if len(cfg.Auth.ClientCerts) > 0 && cfg.TLS.ClientCAFile == "" {
+		fail("auth.client_certs: requires tls.client_ca_file")
+	}
+
+	switch strings.ToLower(cfg.Tracing.Exporter) {
+	case "", tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		fail("tracing.exporter: %q must be none, stdout or otlp", cfg.Tracing.Exporter)
+	}
+
+	if cfg.Sanctions.Threshold <= 0 || cfg.Sanctions.Threshold > 1 {
+		fail("sanctions.threshold: %v must be above 0 and at most 1", cfg.Sanctions.Threshold)
+	}
+	if cfg.Duplicates.Window < 0 {
+		fail("duplicates.window: must not be negative")
+	}
+
+	// sorted so a routing number listed twice is always reported the same way
+	channels := make([]string, 0, len(cfg.Sequences.Channels))
+	for channel := range cfg.Sequences.Channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	channelOf := map[string]string{}
+	for _, channel := range channels {
+		rtns := cfg.Sequences.Channels[channel]
+		switch {
+		case channel == "":
+			fail("sequences.channels: channel name required")
+		case len(channel) > maxChannelName:
+			fail("sequences.channels: channel name %q is longer than %d characters", channel, maxChannelName)
+		case isRTN(channel):
+			// would share a sequence with the routing number of that name
+			fail("sequences.channels: channel name %q must not be a routing number", channel)
+		}
+		for _, rtn := range rtns {
+			if !isRTN(rtn) {
+				fail("sequences.channels.%s: %q is not a 9 digit routing number", channel, rtn)
+			} else if other, ok := channelOf[rtn]; ok {
+				fail("sequences.channels.%s: %s is already in channel %s", channel, rtn, other)
+			}
+			channelOf[rtn] = channel
+		}
+	}
+	if cfg.Sequences.GapTimeout <= 0 {
+		fail("sequences.gap_timeout: must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// checks if s looks like a routing number
+func isRTN(s string) bool {
+	if len(s) != 9 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ConnString builds the Postgres connection URL, escaping the credentials
+func (db Database) ConnString() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(db.User, db.Password),
+		Host:     net.JoinHostPort(db.Host, strconv.Itoa(db.Port)),
+		Path:     "/" + db.Name,
+		RawQuery: "sslmode=" + url.QueryEscape(db.SSLMode),
+	}
+	return u.String()
+}
+
+// Options converts the settings for the cors package; the login cookie
+// makes every allowed request a credentialed one
+func (c CORS) Options() cors.Options {
+	return cors.Options{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		MaxAge:           c.MaxAge,
+		AllowCredentials: true,
+	}
+}
+
+// CertRoles maps each trusted client certificate common name to its roles
+func (a Auth) CertRoles() map[string][]string {
+	roles := make(map[string][]string, len(a.ClientCerts))
+	for _, cc := range a.ClientCerts {
+		roles[cc.CommonName] = cc.Roles
+	}
+	return roles
+}
+
+// User returns the configured account named username
+func (a Auth) User(username string) (User, bool) {
+	for _, u := range a.Users {
+		if u.Username == username {
+			return u, true
+		}
+	}
+	return User{}, false
+}
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "test-secret-0123456789abcdef0123456789"
+
+// writes content to a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// sets the minimum environment needed for a valid config
+func setRequiredEnv(t *testing.T) {
+	t.Setenv("DB_USER", "postgres")
+	t.Setenv("DB_NAME", "pillar_bank")
+	t.Setenv("JWT_SECRET", testSecret)
+}
+
+func load(args ...string) (*Config, error) {
+	return Load(flag.NewFlagSet("test", flag.ContinueOnError), args)
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := load()
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", cfg.Addr)
+	assert.Equal(t, []string{"http://localhost:3000"}, cfg.CORS.AllowedOrigins)
+	assert.Equal(t, 15*time.Minute, cfg.Auth.TokenTTL)
+	assert.Equal(t, "localhost", cfg.Auth.CookieDomain)
+	assert.Equal(t, 5432, cfg.Database.Port)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	setRequiredEnv(t)
+	path := writeFile(t, "config.yaml", `
+addr: ":9000"
+log_level: warn
+database:
+  host: db.internal
+  port: 6543
+auth:
+  token_ttl: 5m
+  users:
+    - username: user1
+      password: password1
+      roles: [operator]
+`)
+
+	t.Run("file overrides defaults", func(t *testing.T) {
+		cfg, err := load("-config", path)
+		require.NoError(t, err)
+		assert.Equal(t, ":9000", cfg.Addr)
+		assert.Equal(t, "warn", cfg.LogLevel)
+		assert.Equal(t, "db.internal", cfg.Database.Host)
+		assert.Equal(t, 6543, cfg.Database.Port)
+		assert.Equal(t, 5*time.Minute, cfg.Auth.TokenTTL)
+		assert.Equal(t, "disable", cfg.Database.SSLMode, "unset keys keep their defaults")
+
+		user, ok := cfg.Auth.User("user1")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"operator"}, user.Roles)
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", path)
+		t.Setenv("HTTP_ADDR", ":9100")
+		t.Setenv("DB_PORT", "7000")
+
+		cfg, err := load()
+		require.NoError(t, err)
+		assert.Equal(t, ":9100", cfg.Addr)
+		assert.Equal(t, 7000, cfg.Database.Port)
+		assert.Equal(t, "db.internal", cfg.Database.Host)
+	})
+
+	t.Run("flags override env", func(t *testing.T) {
+		t.Setenv("HTTP_ADDR", ":9100")
+		t.Setenv("LOG_LEVEL", "error")
+
+		cfg, err := load("-config", path, "-addr", ":9200", "-log-level", "debug")
+		require.NoError(t, err)
+		assert.Equal(t, ":9200", cfg.Addr)
+		assert.Equal(t, "debug", cfg.LogLevel)
+	})
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	setRequiredEnv(t)
+	os.Unsetenv("JWT_SECRET")
+	t.Setenv("JWT_SECRET_FILE", writeFile(t, "jwt_secret", testSecret+"\n"))
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db_password", "s3cret:/@\n"))
+
+	cfg, err := load()
+	require.NoError(t, err)
+	assert.Equal(t, testSecret, cfg.Auth.JWTSecret)
+	assert.Equal(t, "s3cret:/@", cfg.Database.Password)
+	assert.Contains(t, cfg.Database.ConnString(), "s3cret%3A%2F%40@localhost:5432/pillar_bank")
+
+	t.Run("value and file both set", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "other")
+
+		_, err := load()
+		assert.ErrorContains(t, err, "DB_PASSWORD and DB_PASSWORD_FILE are both set")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+
+		_, err := load()
+		assert.ErrorContains(t, err, "DB_PASSWORD_FILE")
+	})
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		file     string
+		expected []string
+	}{
+		{
+			name: "reports every invalid setting",
+			env: map[string]string{
+				"DB_NAME":              "",
+				"JWT_SECRET":           "short",
+				"LOG_LEVEL":            "loud",
+				"CORS_ALLOWED_ORIGINS": "localhost:3000",
+				"OTEL_TRACES_EXPORTER": "jaeger",
+			},
+			expected: []string{
+				"database.name: required",
+				"auth.jwt_secret: must be at least 32 bytes",
+				"log_level:",
+				`cors: origin "localhost:3000"`,
+				`tracing.exporter: "jaeger"`,
+			},
+		},
+		{
+			name:     "malformed number",
+			env:      map[string]string{"DB_PORT": "five"},
+			expected: []string{`DB_PORT: "five" is not a number`},
+		},
+		{
+			name:     "body limit",
+			env:      map[string]string{"MAX_BODY_BYTES": "0"},
+			expected: []string{"max_body_bytes: must be positive"},
+		},
+		{
+			name:     "sanctions threshold",
+			env:      map[string]string{"SANCTIONS_THRESHOLD": "1.5"},
+			expected: []string{"sanctions.threshold: 1.5 must be above 0 and at most 1"},
+		},
+		{
+			name:     "duplicate window",
+			env:      map[string]string{"DUPLICATE_WINDOW": "-1h"},
+			expected: []string{"duplicates.window: must not be negative"},
+		},
+		{
+			name: "bad sequence channels",
+			env:  map[string]string{"SEQUENCE_GAP_TIMEOUT": "0s"},
+			file: `
+sequences:
+  channels:
+    partner-a: ["021000021", "12345"]
+    partner-b: ["021000021"]
+    "121145307": ["121145307"]
+`,
+			expected: []string{
+				`sequences.channels: channel name "121145307" must not be a routing number`,
+				`sequences.channels.partner-a: "12345" is not a 9 digit routing number`,
+				"sequences.channels.partner-b: 021000021 is already in channel partner-a",
+				"sequences.gap_timeout: must be positive",
+			},
+		},
+		{
+			name:     "malformed duration",
+			env:      map[string]string{"TOKEN_TTL": "forever"},
+			expected: []string{`TOKEN_TTL: "forever" is not a duration`},
+		},
+		{
+			name: "incomplete tls",
+			env:  map[string]string{"TLS_KEY_FILE": "key.pem", "TLS_CLIENT_AUTH": "maybe"},
+			file: "auth:\n  client_certs:\n    - common_name: partner-a\n      roles: [operator]\n",
+			expected: []string{
+				"tls: cert_file and key_file must be set together",
+				`tls.client_auth: "maybe" must be optional or require`,
+				"auth.client_certs: requires tls.client_ca_file",
+			},
+		},
+		{
+			name:     "unknown key in file",
+			file:     "databse:\n  host: db\n",
+			expected: []string{"field databse not found"},
+		},
+		{
+			name: "bad users",
+			file: `
+auth:
+  users:
+    - username: user1
+      password: password1
+      roles: [admin]
+    - username: user1
+`,
+			expected: []string{
+				`auth.users[0]: unknown role "admin"`,
+				`auth.users[1]: duplicate username "user1"`,
+				"auth.users[1]: password required",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			var args []string
+			if tt.file != "" {
+				args = []string{"-config", writeFile(t, "config.yaml", tt.file)}
+			}
+
+			_, err := load(args...)
+			require.Error(t, err)
+			for _, msg := range tt.expected {
+				assert.ErrorContains(t, err, msg)
+			}
+		})
+	}
+}
+
+func TestSequenceNamespaces(t *testing.T) {
+	s := Sequences{Channels: map[string][]string{
+		"partner-a": {"021000021", "021000089"},
+		"partner-b": {"121145307"},
+	}}
+	assert.Equal(t, map[string]string{
+		"021000021": "partner-a",
+		"021000089": "partner-a",
+		"121145307": "partner-b",
+	}, s.Namespaces())
+}
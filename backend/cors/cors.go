@@ -0,0 +1,250 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Options describes which cross-origin browser requests are allowed. An
+// allowed origin is either exact, like https://app.example.com, or a
+// subdomain pattern, like https://*.example.com, which matches any
+// subdomain of example.com on the same scheme and port but not
+// example.com itself.
+type Options struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAge           time.Duration
+	AllowCredentials bool
+}
+
+// subdomain pattern compiled from an allowed origin
+type originPattern struct {
+	prefix string // scheme://
+	suffix string // .example.com[:port]
+}
+
+// Policy is a validated set of Options
+type Policy struct {
+	origins       map[string]bool
+	patterns      []originPattern
+	methods       map[string]bool
+	headers       map[string]bool
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+	allowCreds    bool
+}
+
+// New validates opts and builds a policy from them
+func New(opts Options) (*Policy, error) {
+	p := &Policy{
+		origins:    map[string]bool{},
+		methods:    map[string]bool{},
+		headers:    map[string]bool{},
+		allowCreds: opts.AllowCredentials,
+	}
+
+	for _, origin := range opts.AllowedOrigins {
+		if err := p.addOrigin(origin); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, method := range opts.AllowedMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" {
+			return nil, fmt.Errorf("empty method")
+		}
+		p.methods[method] = true
+	}
+	for _, header := range opts.AllowedHeaders {
+		header = strings.TrimSpace(header)
+		if header == "" || header == "*" {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	if opts.MaxAge < 0 {
+		return nil, fmt.Errorf("max age must not be negative")
+	}
+
+	p.allowMethods = strings.Join(upper(opts.AllowedMethods), ", ")
+	p.allowHeaders = strings.Join(canonical(opts.AllowedHeaders), ", ")
+	p.exposeHeaders = strings.Join(canonical(opts.ExposedHeaders), ", ")
+	if opts.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+
+	return p, nil
+}
+
+// validates and records one allowed origin or pattern
+func (p *Policy) addOrigin(origin string) error {
+	origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+
+	// a bare * would let any site make credentialed requests
+	if origin == "*" {
+		return fmt.Errorf("origin %q is not allowed, list origins explicitly", origin)
+	}
+
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || scheme == "" || host == "" {
+		return fmt.Errorf("origin %q is not a scheme://host[:port] origin", origin)
+	}
+
+	if strings.HasPrefix(host, "*.") {
+		rest := host[1:]
+		if strings.Contains(rest, "*") || !validHost(scheme+"://x"+rest) {
+			return fmt.Errorf("origin pattern %q must look like scheme://*.example.com", origin)
+		}
+		p.patterns = append(p.patterns, originPattern{prefix: scheme + "://", suffix: rest})
+		return nil
+	}
+
+	if strings.Contains(host, "*") || !validHost(origin) {
+		return fmt.Errorf("origin %q is not a scheme://host[:port] origin", origin)
+	}
+	p.origins[origin] = true
+	return nil
+}
+
+// checks that origin has a scheme and host and nothing else
+func validHost(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+// AllowsOrigin checks if origin is listed or matches a listed pattern
+func (p *Policy) AllowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+
+	for _, pat := range p.patterns {
+		if !strings.HasPrefix(origin, pat.prefix) || !strings.HasSuffix(origin, pat.suffix) {
+			continue
+		}
+		sub := origin[len(pat.prefix) : len(origin)-len(pat.suffix)]
+		if isSubdomain(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// checks if s is one or more DNS labels
+func isSubdomain(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Middleware answers preflight requests and adds CORS headers to responses
+// for allowed origins. Responses always vary on Origin so caches never
+// serve one origin's headers to another.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		if !p.AllowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// without CORS headers the browser withholds the response
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Origin", origin)
+		if p.allowCreds {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if p.exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", p.exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		if !p.allowsPreflight(c.GetHeader("Access-Control-Request-Method"), c.GetHeader("Access-Control-Request-Headers")) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", p.allowMethods)
+		if p.allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", p.allowHeaders)
+		}
+		if p.maxAge != "" {
+			header.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// checks the method and every header a preflight asks to use
+func (p *Policy) allowsPreflight(method, requestHeaders string) bool {
+	if !p.methods[strings.ToUpper(method)] {
+		return false
+	}
+	for _, h := range strings.Split(requestHeaders, ",") {
+		if h = strings.TrimSpace(h); h != "" && !p.headers[http.CanonicalHeaderKey(h)] {
+			return false
+		}
+	}
+	return true
+}
+
+func upper(items []string) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, strings.ToUpper(strings.TrimSpace(item)))
+	}
+	return out
+}
+
+func canonical(items []string) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, http.CanonicalHeaderKey(strings.TrimSpace(item)))
+	}
+	return out
+}
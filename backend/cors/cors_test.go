@@ -0,0 +1,169 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testOptions = Options{
+	AllowedOrigins:   []string{"http://localhost:3000", "https://*.pillar-bank.example"},
+	AllowedMethods:   []string{"GET", "POST"},
+	AllowedHeaders:   []string{"Content-Type", "Authorization", "Idempotency-Key"},
+	ExposedHeaders:   []string{"X-Request-ID"},
+	MaxAge:           10 * time.Minute,
+	AllowCredentials: true,
+}
+
+// routes requests through the policy to a handler that answers 200
+func newRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	policy, err := New(testOptions)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(policy.Middleware())
+	router.GET("/wire-messages", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/wire-messages", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return router
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	policy, err := New(testOptions)
+	require.NoError(t, err)
+
+	tests := []struct {
+		origin   string
+		expected bool
+	}{
+		{"http://localhost:3000", true},
+		{"HTTP://LOCALHOST:3000", true},
+		{"http://localhost:3001", false},
+		{"https://localhost:3000", false},
+		{"https://app.pillar-bank.example", true},
+		{"https://eu.app.pillar-bank.example", true},
+		{"https://pillar-bank.example", false},
+		{"http://app.pillar-bank.example", false},
+		{"https://evilpillar-bank.example", false},
+		{"https://app.pillar-bank.example.evil.example", false},
+		{"https://app.pillar-bank.example:8443", false},
+		{"https://a_b.pillar-bank.example", false},
+		{"null", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policy.AllowsOrigin(tt.origin))
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	router := newRouter(t)
+
+	tests := []struct {
+		name         string
+		origin       string
+		method       string
+		headers      string
+		expectedCode int
+	}{
+		{"allowed", "http://localhost:3000", "POST", "Content-Type, Idempotency-Key", http.StatusNoContent},
+		{"allowed pattern", "https://app.pillar-bank.example", "POST", "authorization", http.StatusNoContent},
+		{"rejected origin", "https://evil.example", "POST", "Content-Type", http.StatusForbidden},
+		{"rejected method", "http://localhost:3000", "DELETE", "", http.StatusForbidden},
+		{"rejected header", "http://localhost:3000", "POST", "X-Forwarded-User", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodOptions, "/wire-messages", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header().Values("Vary"))
+
+			if tt.expectedCode != http.StatusNoContent {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+				return
+			}
+			assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "Content-Type, Authorization, Idempotency-Key", w.Header().Get("Access-Control-Allow-Headers"))
+			assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+		})
+	}
+}
+
+func TestActualRequest(t *testing.T) {
+	router := newRouter(t)
+
+	t.Run("allowed origin", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/wire-messages", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "http://localhost:3000", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Request-Id", w.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+	})
+
+	t.Run("rejected origin", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/wire-messages", nil)
+		req.Header.Set("Origin", "https://evil.example")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		// the request is served but the browser withholds the response
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+	})
+
+	t.Run("no origin", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/wire-messages", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+	})
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"wildcard origin", Options{AllowedOrigins: []string{"*"}}},
+		{"missing scheme", Options{AllowedOrigins: []string{"localhost:3000"}}},
+		{"path", Options{AllowedOrigins: []string{"http://localhost:3000/app"}}},
+		{"inner wildcard", Options{AllowedOrigins: []string{"https://app.*.example"}}},
+		{"double wildcard", Options{AllowedOrigins: []string{"https://*.*.example"}}},
+		{"wildcard header", Options{AllowedHeaders: []string{"*"}}},
+		{"negative max age", Options{MaxAge: -time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"pillar-bank/audit"
+	"pillar-bank/models"
+	"pillar-bank/problem"
+	"pillar-bank/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// decisions on a suspected duplicate
+const (
+	decisionRelease = "release"
+	decisionCancel  = "cancel"
+)
+
+// releasing or cancelling a suspected duplicate
+var duplicateRule = decisionRule{
+	action:            audit.ActionWireOverride,
+	from:              models.StatusSuspectedDuplicate,
+	to:                map[string]string{decisionRelease: models.StatusAccepted, decisionCancel: models.StatusCancelled},
+	wrongStatusCode:   problem.CodeNotSuspectedDuplicate,
+	wrongStatusDetail: "Only wire messages suspected to be duplicates can be released or cancelled",
+}
+
+// findDuplicate returns the seq of the earliest wire stored within window
+// of now with the same routing numbers, accounts and amount as wm, or nil
+// when there is none. Wires that never moved money are not counted. The
+// database's clock stamped created_at, so it also starts the window.
+func (h *Handler) findDuplicate(ctx context.Context, wm models.WireMessage, window time.Duration) (*int, error) {
+	if window <= 0 {
+		return nil, nil
+	}
+
+	query := `SELECT seq FROM wire_messages
+		WHERE sender_rtn = $1 AND sender_an_idx = $2 AND receiver_rtn = $3 AND receiver_an_idx = $4
+		AND amount = $5 AND created_at >= CURRENT_TIMESTAMP - make_interval(secs => $6) AND status <> ALL($7)
+		ORDER BY created_at ASC, id ASC LIMIT 1`
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	var seq int
+	err := h.db.QueryRowContext(ctx, query, wm.SenderRTN, h.enc.BlindIndex(wm.SenderAN), wm.ReceiverRTN, h.enc.BlindIndex(wm.ReceiverAN),
+		wm.Amount, window.Seconds(), voidStatuses).Scan(&seq)
+	if err == sql.ErrNoRows {
+		tracing.End(span, nil)
+		return nil, nil
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &seq, nil
+}
+
+// overrideDuplicate releases a suspected duplicate, accepting it, or
+// cancels it
+func (h *Handler) overrideDuplicate(c *gin.Context) {
+	h.decideWire(c, duplicateRule)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pillar-bank/auth"
+	"pillar-bank/codec"
+	"pillar-bank/models"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tests that an unknown status filter is refused before the database is touched
+func TestGetWireMessagesUnknownStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{codecs: codec.Default()}
+	router := gin.New()
+	router.GET("/wire-messages", asPrincipal(auth.RoleOperator), h.getWireMessages)
+
+	w := do(router, http.MethodGet, "/wire-messages?status=PENDING", "")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assertProblem(t, w, problem.CodeInvalidParameter)
+}
+
+func TestDuplicateDetection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	require.NoError(t, cleanTestDB(db))
+
+	h := testHandler(t, db)
+	h.duplicateWindow = time.Hour
+	router := gin.New()
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
+	router.GET("/wire-messages", asPrincipal(auth.RoleOperator), h.getWireMessages)
+	router.POST("/wire-message/:seq/duplicate", asPrincipal(auth.RoleSupervisor), h.overrideDuplicate)
+	router.POST("/review-queue/:seq", asPrincipal(auth.RoleCompliance), h.reviewWireMessage)
+
+	override := func(seq, body string) *httptest.ResponseRecorder {
+		return do(router, http.MethodPost, "/wire-message/"+seq+"/duplicate", body)
+	}
+	const wire = ";sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=2500"
+
+	t.Run("Original is accepted", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages", "seq=50"+wire)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("Link"))
+	})
+
+	t.Run("Resubmission is suspected", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages", "seq=51"+wire)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, `</wire-message/50?namespace=021000021>; rel="related"`, w.Header().Get("Link"))
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusSuspectedDuplicate, response.Status)
+		require.NotNil(t, response.DuplicateOf)
+		assert.Equal(t, 50, *response.DuplicateOf)
+	})
+
+	t.Run("Different amount is not a duplicate", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages", "seq=52;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=2501")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Suspected duplicates can be listed", func(t *testing.T) {
+		w := do(router, http.MethodGet, "/wire-messages?status=SUSPECTED_DUPLICATE", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var listed []models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+		require.Len(t, listed, 1)
+		assert.Equal(t, 51, listed[0].Seq)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		w := override("51", `{"decision": "cancel", "note": "client retried"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusCancelled, response.Status)
+		assert.Equal(t, 50, *response.DuplicateOf)
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages", "seq=53"+wire)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		w = override("53", `{"decision": "release", "note": "second instalment"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusAccepted, response.Status)
+	})
+
+	t.Run("Wire not suspected", func(t *testing.T) {
+		w := override("50", `{"decision": "release"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assertProblem(t, w, problem.CodeNotSuspectedDuplicate)
+	})
+
+	t.Run("Review decisions do not apply", func(t *testing.T) {
+		w := override("53", `{"decision": "clear"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assertProblem(t, w, problem.CodeInvalidParameter)
+	})
+
+	t.Run("Held duplicate goes to a supervisor once cleared", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages", "seq=54"+wire+";beneficiary_name=Jonathan Doe")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusHold, response.Status)
+		require.NotNil(t, response.DuplicateOf)
+
+		w = do(router, http.MethodPost, "/review-queue/54", `{"decision": "clear"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusSuspectedDuplicate, response.Status)
+
+		w = override("54", `{"decision": "release"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusAccepted, response.Status)
+	})
+}
@@ -0,0 +1,189 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// prefix of every value produced by Encrypt
+const versionPrefix = "v1"
+
+// Envelope encrypts field values with a fresh AES-256-GCM data key per value.
+// The data key is wrapped by the primary master key and stored alongside the
+// ciphertext, so rotating the master key only requires re-wrapping.
+type Envelope struct {
+	keys     map[string][]byte
+	primary  string
+	indexKey []byte
+}
+
+// NewEnvelope creates an envelope from master keys. The first key is the
+// primary used for new values; the rest are only used to decrypt.
+func NewEnvelope(masterKeys ...[]byte) (*Envelope, error) {
+	if len(masterKeys) == 0 {
+		return nil, fmt.Errorf("at least one master key is required")
+	}
+
+	e := &Envelope{keys: make(map[string][]byte, len(masterKeys))}
+	for i, key := range masterKeys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key %d must be 32 bytes, got %d", i+1, len(key))
+		}
+		id := KeyID(key)
+		e.keys[id] = key
+		if i == 0 {
+			e.primary = id
+		}
+	}
+
+	mac := hmac.New(sha256.New, masterKeys[0])
+	mac.Write([]byte("pillar-bank blind index v1"))
+	e.indexKey = mac.Sum(nil)
+
+	return e, nil
+}
+
+// KeyID returns the short identifier a master key is referenced by
+func KeyID(masterKey []byte) string {
+	sum := sha256.Sum256(masterKey)
+	return hex.EncodeToString(sum[:4])
+}
+
+// PrimaryKeyID returns the id of the master key new values are wrapped with
+func (e *Envelope) PrimaryKeyID() string {
+	return e.primary
+}
+
+// seals plaintext with a fresh nonce, returning nonce||ciphertext
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// opens nonce||ciphertext produced by seal
+func open(key, sealed, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+// Encrypt seals plaintext for storage. The context (typically the column
+// name) is authenticated, so a value cannot be moved to another field.
+func (e *Envelope) Encrypt(plaintext, context string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(e.keys[e.primary], dataKey, []byte(e.primary))
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(dataKey, []byte(plaintext), []byte(context))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		versionPrefix,
+		e.primary,
+		base64.RawStdEncoding.EncodeToString(wrapped),
+		base64.RawStdEncoding.EncodeToString(sealed),
+	}, ":"), nil
+}
+
+// splits a stored value into its key id, wrapped data key and ciphertext
+func parse(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 || parts[0] != versionPrefix {
+		return "", nil, nil, fmt.Errorf("value is not encrypted")
+	}
+
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed data key: %w", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed ciphertext: %w", err)
+	}
+
+	return parts[1], wrapped, sealed, nil
+}
+
+// Decrypt opens a value produced by Encrypt with the same context
+func (e *Envelope) Decrypt(value, context string) (string, error) {
+	keyID, wrapped, sealed, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	masterKey, ok := e.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown master key %s", keyID)
+	}
+
+	dataKey, err := open(masterKey, wrapped, []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	plaintext, err := open(dataKey, sealed, []byte(context))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value looks like the output of Encrypt
+func IsEncrypted(value string) bool {
+	_, _, _, err := parse(value)
+	return err == nil
+}
+
+// NeedsRotation reports whether value is plaintext or wrapped by a master
+// key other than the primary
+func (e *Envelope) NeedsRotation(value string) bool {
+	keyID, _, _, err := parse(value)
+	return err != nil || keyID != e.primary
+}
+
+// BlindIndex returns a deterministic keyed hash of value, so equality
+// lookups work without storing the plaintext
+func (e *Envelope) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, e.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,128 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, 32)
+	newKey = bytes.Repeat([]byte{2}, 32)
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	env, err := NewEnvelope(oldKey)
+	require.NoError(t, err)
+
+	ciphertext, err := env.Encrypt("537646894897833", "sender_an")
+	require.NoError(t, err)
+	assert.NotContains(t, ciphertext, "537646894897833")
+	assert.True(t, IsEncrypted(ciphertext))
+
+	plaintext, err := env.Decrypt(ciphertext, "sender_an")
+	require.NoError(t, err)
+	assert.Equal(t, "537646894897833", plaintext)
+
+	t.Run("Randomized", func(t *testing.T) {
+		again, err := env.Encrypt("537646894897833", "sender_an")
+		require.NoError(t, err)
+		assert.NotEqual(t, ciphertext, again)
+	})
+
+	t.Run("Wrong context", func(t *testing.T) {
+		_, err := env.Decrypt(ciphertext, "receiver_an")
+		assert.Error(t, err)
+	})
+
+	t.Run("Tampered ciphertext", func(t *testing.T) {
+		tampered := ciphertext[:len(ciphertext)-2] + "AA"
+		if tampered == ciphertext {
+			tampered = ciphertext[:len(ciphertext)-2] + "BB"
+		}
+		_, err := env.Decrypt(tampered, "sender_an")
+		assert.Error(t, err)
+	})
+
+	t.Run("Plaintext value", func(t *testing.T) {
+		assert.False(t, IsEncrypted("537646894897833"))
+		_, err := env.Decrypt("537646894897833", "sender_an")
+		assert.Error(t, err)
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	before, err := NewEnvelope(oldKey)
+	require.NoError(t, err)
+	after, err := NewEnvelope(newKey, oldKey)
+	require.NoError(t, err)
+
+	ciphertext, err := before.Encrypt("669907820975207", "receiver_an")
+	require.NoError(t, err)
+
+	// retired keys still decrypt
+	plaintext, err := after.Decrypt(ciphertext, "receiver_an")
+	require.NoError(t, err)
+	assert.Equal(t, "669907820975207", plaintext)
+
+	assert.True(t, after.NeedsRotation(ciphertext))
+	assert.True(t, after.NeedsRotation("669907820975207"))
+
+	rotated, err := after.Encrypt(plaintext, "receiver_an")
+	require.NoError(t, err)
+	assert.False(t, after.NeedsRotation(rotated))
+	assert.True(t, strings.HasPrefix(rotated, "v1:"+KeyID(newKey)+":"))
+
+	// once the old key is dropped, unrotated values are unreadable
+	_, err = before.Decrypt(rotated, "receiver_an")
+	assert.Error(t, err)
+}
+
+func TestBlindIndex(t *testing.T) {
+	env, err := NewEnvelope(oldKey)
+	require.NoError(t, err)
+	other, err := NewEnvelope(newKey)
+	require.NoError(t, err)
+
+	assert.Equal(t, env.BlindIndex("537646894897833"), env.BlindIndex("537646894897833"))
+	assert.NotEqual(t, env.BlindIndex("537646894897833"), env.BlindIndex("537646894897834"))
+	assert.NotEqual(t, env.BlindIndex("537646894897833"), other.BlindIndex("537646894897833"))
+	assert.Len(t, env.BlindIndex("537646894897833"), 64)
+}
+
+func TestNewEnvelopeRejectsBadKeys(t *testing.T) {
+	_, err := NewEnvelope()
+	assert.Error(t, err)
+
+	_, err = NewEnvelope([]byte("short"))
+	assert.EqualError(t, err, "master key 1 must be 32 bytes, got 5")
+}
+
+func TestLoadKeyfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+	content := "# current key\n" + base64.StdEncoding.EncodeToString(newKey) + "\n\n" +
+		"# retired\n" + base64.StdEncoding.EncodeToString(oldKey) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	env, err := LoadKeyfile(path)
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(newKey), env.PrimaryKeyID())
+
+	t.Run("Invalid base64", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "bad.key")
+		require.NoError(t, os.WriteFile(bad, []byte("not base64!\n"), 0o600))
+		_, err := LoadKeyfile(bad)
+		assert.EqualError(t, err, "keyfile line 1: invalid base64")
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := LoadKeyfile(filepath.Join(t.TempDir(), "missing.key"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,90 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ok(context.Context) error { return nil }
+
+// fetches path and decodes the report
+func probe(t *testing.T, checker *Checker, path string) (int, Report) {
+	router := gin.New()
+	router.GET("/livez", LiveHandler())
+	router.GET("/readyz", checker.ReadyHandler())
+
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func TestReadyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("all checks pass", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("database", ok)
+		checker.Add("migrations", ok)
+
+		code, report := probe(t, checker, "/readyz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, StatusOK, report.Status)
+		assert.Len(t, report.Checks, 2)
+		assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	})
+
+	t.Run("one check fails", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("database", func(context.Context) error { return errors.New("connection refused") })
+		checker.Add("migrations", ok)
+
+		code, report := probe(t, checker, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, StatusFail, report.Status)
+		assert.Equal(t, StatusFail, report.Checks["database"].Status)
+		assert.Equal(t, "connection refused", report.Checks["database"].Error)
+		assert.Equal(t, StatusOK, report.Checks["migrations"].Status)
+	})
+
+	t.Run("hung check times out", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+
+		checker := NewChecker(50 * time.Millisecond)
+		checker.Add("database", func(context.Context) error {
+			<-block // ignores ctx
+			return nil
+		})
+
+		start := time.Now()
+		code, report := probe(t, checker, "/readyz")
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["database"].Error)
+	})
+}
+
+func TestLiveHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	checker := NewChecker(time.Second)
+	checker.Add("database", func(context.Context) error { return errors.New("down") })
+
+	// liveness ignores dependencies
+	code, report := probe(t, checker, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+}
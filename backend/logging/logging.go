@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"pillar-bank/redact"
+)
+
+// New creates a JSON logger writing to w at the given level. Output passes
+// through the redacting writer so account numbers never reach the logs.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(redact.NewWriter(w), &slog.HandlerOptions{Level: level}))
+}
+
+// ParseLevel converts debug, info, warn or error to a slog level. An empty
+// string means info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", s)
+}
@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected slog.Level
+		wantErr  bool
+	}{
+		{"", slog.LevelInfo, false},
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", slog.LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			level, err := ParseLevel(tt.input)
+			if tt.wantErr {
+				assert.EqualError(t, err, `invalid log level "verbose": must be debug, info, warn or error`)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, level)
+		})
+	}
+}
+
+// decodes newline-delimited JSON log output
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelDebug)
+
+	router := gin.New()
+	router.Use(RequestID(logger), AccessLog())
+	router.GET("/test", func(c *gin.Context) {
+		FromContext(c).Info("handling", "note", "sender_an=537646894897833")
+		c.JSON(http.StatusOK, gin.H{"request_id": GetRequestID(c)})
+	})
+
+	t.Run("Accepts caller id", func(t *testing.T) {
+		buf.Reset()
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+		assert.JSONEq(t, `{"request_id":"abc-123"}`, w.Body.String())
+
+		lines := decodeLines(t, &buf)
+		require.Len(t, lines, 2)
+		for _, line := range lines {
+			assert.Equal(t, "abc-123", line["request_id"])
+		}
+		assert.Equal(t, "handling", lines[0]["msg"])
+		assert.Equal(t, "sender_an=***********7833", lines[0]["note"])
+		assert.Equal(t, "request completed", lines[1]["msg"])
+		assert.Equal(t, "/test", lines[1]["route"])
+		assert.Equal(t, float64(http.StatusOK), lines[1]["status"])
+	})
+
+	t.Run("Generates missing id", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Len(t, w.Header().Get(RequestIDHeader), 32)
+	})
+
+	t.Run("Replaces unsafe id", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(RequestIDHeader, "bad id\n{injected}")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		id := w.Header().Get(RequestIDHeader)
+		assert.Len(t, id, 32)
+		assert.NotContains(t, id, "injected")
+	})
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelWarn)
+
+	logger.Info("dropped")
+	logger.Warn("kept")
+
+	lines := decodeLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "kept", lines[0]["msg"])
+	assert.Equal(t, "WARN", lines[0]["level"])
+}
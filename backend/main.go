@@ -1,263 +1,631 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
-	"unicode"
+	"sync"
+	"syscall"
+	"time"
 
+	"pillar-bank/audit"
 	"pillar-bank/auth"
+	"pillar-bank/codec"
+	"pillar-bank/config"
+	"pillar-bank/cors"
+	"pillar-bank/encryption"
+	"pillar-bank/health"
+	"pillar-bank/logging"
+	"pillar-bank/metrics"
 	"pillar-bank/models"
+	"pillar-bank/problem"
+	"pillar-bank/ratelimit"
+	"pillar-bank/redact"
+	"pillar-bank/rules"
+	"pillar-bank/sanctions"
+	"pillar-bank/tlsconfig"
+	"pillar-bank/tracing"
+	"pillar-bank/wire"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
 )
 
+// wireMessageColumns lists the columns scanned by Handler.scanWireMessage, in order
+const wireMessageColumns = "id, seq, namespace, sender_rtn, sender_an, receiver_rtn, receiver_an, amount, " +
+	"type_subtype, business_function_code, beneficiary_name, beneficiary_address, beneficiary_reference, " +
+	"originator_name, originator_address, remittance_info, status, screening_hits, risk_score, rule_hits, duplicate_of, raw_message, canonical_message, created_by, created_at"
+
 // Handler manages database operations
 type Handler struct {
-	db *sql.DB
+	cfg     *config.Config
+	db      *sql.DB
+	audit   *audit.Log
+	auth    *auth.Authenticator
+	enc     *encryption.Envelope
+	metrics *metrics.Metrics
+	codecs  *codec.Registry
+	// screener is nil when no sanctions list is configured
+	screener *sanctions.Screener
+	// risk is nil when no rules file is configured
+	risk *rules.Engine
+	// duplicateWindow is how far back probable duplicates are looked for;
+	// 0 turns the check off
+	duplicateWindow time.Duration
+	seqs            sequencing
+}
+
+// responds with a problem+json error carrying a stable code
+func handleError(c *gin.Context, status int, code, detail string) {
+	problem.Abort(c, status, code, detail)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func handleError(c *gin.Context, status int, message string) {
-	c.IndentedJSON(status, gin.H{"error": message})
+// logs a startup failure and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 func main() {
-	// Get database configuration from environment
-	dbHost := os.Getenv("DB_HOST")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dbPort := os.Getenv("DB_PORT")
+	reencryptOnly := flag.Bool("reencrypt", false, "re-encrypt stored wires under the primary master key and exit")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	// Structured JSON logs with account numbers scrubbed
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logger := logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
+	gin.DefaultWriter = redact.NewWriter(os.Stdout)
+	gin.DefaultErrorWriter = redact.NewWriter(os.Stderr)
+
+	// Tracing exports spans per the configured exporter: none (default), stdout or otlp
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.ServiceName, cfg.Tracing.Exporter)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		dbUser, dbPassword, dbHost, dbPort, dbName)
+	// Load the master keys used for encryption at rest
+	enc, err := encryption.LoadKeyfile(cfg.MasterKeyFile)
+	if err != nil {
+		fatal("failed to load master keys", err)
+	}
 
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", cfg.Database.ConnString())
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	// Create table if it doesn't exist
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS wire_messages (
-            id SERIAL PRIMARY KEY,
-            seq INTEGER UNIQUE NOT NULL,
-            sender_rtn VARCHAR(9) NOT NULL,
-            sender_an VARCHAR(255) NOT NULL,
-            receiver_rtn VARCHAR(9) NOT NULL,
-            receiver_an VARCHAR(255) NOT NULL,
-            amount INTEGER NOT NULL,
-            raw_message TEXT NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        )
-    `)
+		fatal("failed to open database", err)
+	}
+	// background workers are waited for before the database is closed
+	var workers sync.WaitGroup
+	defer shutdown(db, &workers, shutdownTracing)
+
+	// Create or upgrade the schema
+	if err := migrate(db); err != nil {
+		fatal("failed to migrate schema", err)
+	}
+
+	// Encrypt legacy plaintext rows and re-wrap rows under retired keys
+	count, err := reencryptWireMessages(db, enc)
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to re-encrypt wire messages", err)
 	}
+	slog.Info("re-encryption complete", "rows", count, "key_id", enc.PrimaryKeyID())
+	if *reencryptOnly {
+		return
+	}
+
+	m := metrics.New()
+	m.RegisterDB(db)
 
 	h := &Handler{
-		db: db,
+		cfg:     cfg,
+		db:      db,
+		audit:   audit.NewLog(db),
+		auth:    auth.NewAuthenticator([]byte(cfg.Auth.JWTSecret), cfg.Auth.TokenTTL).WithClientCerts(cfg.Auth.CertRoles()),
+		enc:     enc,
+		metrics: m,
+		codecs:  codec.Default(),
+
+		duplicateWindow: cfg.Duplicates.Window,
+		seqs: sequencing{
+			channels:   cfg.Sequences.Namespaces(),
+			holdGaps:   cfg.Sequences.HoldGaps,
+			gapTimeout: cfg.Sequences.GapTimeout,
+		},
 	}
 
-	router := gin.Default()
+	// Screen wire parties against the sanctions list, when one is configured
+	if cfg.Sanctions.SDNFile != "" {
+		list, err := sanctions.LoadFile(cfg.Sanctions.SDNFile)
+		if err != nil {
+			fatal("failed to load sanctions list", err)
+		}
+		h.screener = sanctions.NewScreener(list, cfg.Sanctions.Threshold)
+		slog.Info("sanctions list loaded", "entries", list.Len(), "threshold", cfg.Sanctions.Threshold)
+	} else {
+		slog.Warn("sanctions screening disabled, no sdn_file configured")
+	}
 
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+	// Score wires against the fraud and velocity rules, when a file declares them
+	if cfg.Rules.File != "" {
+		h.risk, err = rules.LoadFile(cfg.Rules.File)
+		if err != nil {
+			fatal("failed to load risk rules", err)
+		}
+		slog.Info("risk rules loaded", "rules", h.risk.Len())
+	} else {
+		slog.Warn("risk rules disabled, no rules file configured")
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	// Per-client token buckets, shared across replicas when kept in Postgres
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		var store ratelimit.Store = ratelimit.NewMemoryStore()
+		if cfg.RateLimit.Store == config.RateLimitStorePostgres {
+			store = ratelimit.NewPostgresStore(db, ratelimit.RefillTime(cfg.RateLimit.Limits()))
 		}
+		limiter = ratelimit.New(store, cfg.RateLimit.Limits())
+	}
 
-		c.Next()
-	})
+	corsPolicy, err := cors.New(cfg.CORS.Options())
+	if err != nil {
+		fatal("invalid CORS policy", err)
+	}
+
+	router := gin.New()
+	router.Use(logging.RequestID(logger), tracing.Middleware(), logging.AccessLog(), m.Middleware(), gin.Recovery())
+
+	// bound how much of a request body any handler will read
+	router.Use(limitBody(cfg.MaxBodyBytes))
 
+	// answer preflights and mark responses readable by the allowed frontends
+	router.Use(corsPolicy.Middleware())
+
+	// record every authentication and authorization failure
+	router.Use(h.audit.DenialMiddleware())
+
+	// reject cross-site form posts riding on the login cookie
+	router.Use(auth.CSRFMiddlewareFunc(corsPolicy.AllowsOrigin))
+
+	// kept for existing clients; orchestrators should probe /livez and /readyz
 	router.GET("/health", func(c *gin.Context) {
 		c.IndentedJSON(http.StatusOK, gin.H{
 			"message": "API is working",
 		})
 	})
+	router.GET("/livez", health.LiveHandler())
+	router.GET("/readyz", readinessChecks(db, enc).ReadyHandler())
+
+	router.GET("/metrics", m.Handler())
+
+	router.POST("/login", limiter.Middleware(ratelimit.GroupLogin), h.login)
+	router.GET("/me", h.auth.AuthenticateMiddleware, me)
+	router.GET("/wire-messages", h.auth.AuthenticateMiddleware, limiter.Middleware(ratelimit.GroupWireRead), h.getWireMessages)
+	router.GET("/wire-message/:seq", h.auth.AuthenticateMiddleware, limiter.Middleware(ratelimit.GroupWireRead), h.getWireMessage)
+	router.POST("/wire-messages", h.auth.AuthenticateMiddleware, limiter.Middleware(ratelimit.GroupWireWrite), h.postWireMessage)
+	router.GET("/audit", h.auth.AuthenticateMiddleware, auth.RequireRole(auth.RoleAuditor), h.getAuditLog)
+	router.GET("/review-queue", h.auth.AuthenticateMiddleware, auth.RequireRole(auth.RoleCompliance), limiter.Middleware(ratelimit.GroupWireRead), h.getReviewQueue)
+	router.POST("/review-queue/:seq", h.auth.AuthenticateMiddleware, auth.RequireRole(auth.RoleCompliance), limiter.Middleware(ratelimit.GroupWireWrite), h.reviewWireMessage)
+	router.POST("/wire-message/:seq/duplicate", h.auth.AuthenticateMiddleware, auth.RequireRole(auth.RoleSupervisor), limiter.Middleware(ratelimit.GroupWireWrite), h.overrideDuplicate)
+	router.GET("/sequences", h.auth.AuthenticateMiddleware, limiter.Middleware(ratelimit.GroupWireRead), h.getSequences)
+
+	// SIGTERM or SIGINT stops accepting connections and drains in-flight requests
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Release wires whose sequence gap filled or timed out
+	if cfg.Sequences.HoldGaps {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			h.watchSequenceGaps(ctx, sequenceSweepInterval)
+		}()
+	}
 
-	router.POST("/login", login)
-	router.GET("/wire-messages", auth.AuthenticateMiddleware, h.getWireMessages)
-	router.GET("/wire-message/:seq", auth.AuthenticateMiddleware, h.getWireMessage)
-	router.POST("/wire-messages", auth.AuthenticateMiddleware, h.postWireMessage)
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		fatal("failed to listen", err)
+	}
+
+	// Terminate TLS, and verify partner bank client certificates, when configured
+	if cfg.TLS.Enabled() {
+		certs, err := tlsconfig.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			fatal("failed to load TLS certificate", err)
+		}
+		go certs.Watch(ctx, cfg.TLS.ReloadInterval)
 
-	router.Run(":8080")
+		tlsCfg, err := tlsconfig.Server(certs, cfg.TLS.ClientCAFile, cfg.TLS.ClientAuth)
+		if err != nil {
+			fatal("failed to configure TLS", err)
+		}
+		ln = tls.NewListener(ln, tlsCfg)
+	}
+
+	slog.Info("listening", "addr", ln.Addr().String(), "tls", cfg.TLS.Enabled(), "mtls", cfg.TLS.ClientCAFile != "")
+	if err := serve(ctx, newServer(router), ln, drainTimeout); err != nil {
+		slog.Error("server stopped", "error", err)
+	}
 }
 
 // login authenticates users and returns a JWT token
-func login(c *gin.Context) {
+func (h *Handler) login(c *gin.Context) {
 	username := c.PostForm("username")
 	password := c.PostForm("password")
 
-	validCredentials := map[string]string{
-		"user1": "password1",
-		"user2": "password2",
-	}
-
-	if storedPassword, exists := validCredentials[username]; exists && storedPassword == password {
-		tokenString, err := auth.CreateToken(username)
+	user, exists := h.cfg.Auth.User(username)
+	if exists && subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1 {
+		tokenString, err := h.auth.CreateToken(username, user.Roles...)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating token"})
+			h.metrics.LoginAttempt(false)
+			h.audit.RecordAs(c, username, audit.ActionLogin, "", audit.OutcomeFailure, "error creating token")
+			problem.Internal(c, "failed to create token", err)
 			return
 		}
 
-		c.SetCookie("token", tokenString, 900, "/", "localhost", false, true) // token expires in 15 minutes
+		h.metrics.LoginAttempt(true)
+		h.audit.RecordAs(c, username, audit.ActionLogin, "", audit.OutcomeSuccess, "")
+
+		// strict same-site keeps the cookie off cross-site requests; secure only when served over TLS
+		c.SetSameSite(http.SameSiteStrictMode)
+		// the cookie expires with the token
+		c.SetCookie("token", tokenString, int(h.auth.TokenTTL().Seconds()), "/", h.cfg.Auth.CookieDomain, c.Request.TLS != nil, true)
 		c.JSON(http.StatusOK, gin.H{"message": "Successfully logged in"})
 	} else {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		h.metrics.LoginAttempt(false)
+		h.audit.RecordAs(c, username, audit.ActionLogin, "", audit.OutcomeFailure, "invalid credentials")
+		handleError(c, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Username or password is incorrect")
 	}
 }
 
-// checks if a string is an integer
-func isInt(s string) bool {
-	for _, c := range s {
-		if !unicode.IsDigit(c) {
-			return false
-		}
+// me returns the principal making the request
+func me(c *gin.Context) {
+	principal, ok := auth.GetPrincipal(c)
+	if !ok {
+		handleError(c, http.StatusUnauthorized, problem.CodeAuthenticationRequired, "Log in to access this resource")
+		return
 	}
-	return true
+
+	c.IndentedJSON(http.StatusOK, principal)
 }
 
-// parseWireMessage validates and parses wire message string into structured data
-func parseWireMessage(message string) (models.WireMessage, error) {
-	wireMessage := models.WireMessage{}
-	parts := strings.Split(message, ";")
-	fmt.Println("Received message:", message)
-	fmt.Println("Parts:", parts)
+// rejection reason for a seq that is already taken; every other reason
+// comes from the wire package
+const reasonDuplicateSeq = "duplicate_seq"
+
+// reasons a wire is held, as metric label values
+const (
+	holdReasonSanctions = "sanctions"
+	holdReasonRules     = "rules"
+	holdReasonDuplicate = "duplicate"
+	holdReasonSequence  = "sequence"
+)
+
+// rejection reason for a wire the risk rules scored too high
+const reasonRules = "rules"
 
-	if len(parts) != 6 {
-		return wireMessage, fmt.Errorf("invalid message format: must contain all information")
+// encodes hits as a JSON array for storage, or "" when there are none
+func encodeHits[T any](hits []T) (string, error) {
+	if len(hits) == 0 {
+		return "", nil
 	}
+	encoded, err := json.Marshal(hits)
+	return string(encoded), err
+}
 
-	for _, part := range parts {
-		keyValue := strings.Split(part, "=")
-		if len(keyValue) != 2 {
-			continue
-		}
+// builds the 400 problem for a parse error, with one entry per violation
+func wireProblem(err error) *problem.Problem {
+	var verrs wire.Errors
+	if !errors.As(err, &verrs) {
+		verrs = wire.Errors{{Reason: rejectionReason(err), Message: err.Error()}}
+	}
 
-		key := strings.TrimSpace(keyValue[0])
-		value := strings.TrimSpace(keyValue[1])
-
-		// build wire message from parts with validation checking
-		switch key {
-		case "seq":
-			if !isInt(value) {
-				return wireMessage, fmt.Errorf("invalid SEQ format: must be numeric")
-			}
-			seqNum, _ := strconv.Atoi(value)
-			wireMessage.Seq = seqNum
-		case "sender_rtn":
-			if !isInt(value) || len(value) != 9 {
-				return wireMessage, fmt.Errorf("invalid RTN format: must be exactly 9 digits")
-			}
-			wireMessage.SenderRTN = value
-		case "sender_an":
-			if !isInt(value) {
-				return wireMessage, fmt.Errorf("invalid AN format: must be numeric")
-			}
-			wireMessage.SenderAN = value
-		case "receiver_rtn":
-			if !isInt(value) || len(value) != 9 {
-				return wireMessage, fmt.Errorf("invalid RTN format: must be exactly 9 digits")
-			}
-			wireMessage.ReceiverRTN = value
-		case "receiver_an":
-			if !isInt(value) {
-				return wireMessage, fmt.Errorf("invalid AN format: must be numeric")
-			}
-			wireMessage.ReceiverAN = value
-		case "amount":
-			if !isInt(value) {
-				return wireMessage, fmt.Errorf("invalid amount format: must be numeric")
-			}
-			amount, _ := strconv.Atoi(value)
-
-			if amount < 0 {
-				return wireMessage, fmt.Errorf("invalid amount format: must be positive")
-			}
-
-			wireMessage.Amount = amount
+	fieldErrs := make([]problem.FieldError, 0, len(verrs))
+	for _, verr := range verrs {
+		fieldErr := problem.FieldError{Code: strings.ToUpper(verr.Reason), Detail: verr.Message}
+		if verr.Field != "" {
+			fieldErr.Pointer = "/" + verr.Field
 		}
+		fieldErrs = append(fieldErrs, fieldErr)
+	}
+
+	// a single violation keeps its own code so clients can react to it directly
+	if len(fieldErrs) == 1 {
+		return problem.New(http.StatusBadRequest, fieldErrs[0].Code, fieldErrs[0].Detail).WithErrors(fieldErrs...)
 	}
+	detail := fmt.Sprintf("wire message has %d errors", len(fieldErrs))
+	return problem.New(http.StatusBadRequest, problem.CodeValidationFailed, detail).WithErrors(fieldErrs...)
+}
 
-	wireMessage.RawMessage = message
-	return wireMessage, nil
+// returns the rejection reason for a parse error, the first violation's when
+// there are several
+func rejectionReason(err error) string {
+	var verr *wire.Error
+	if errors.As(err, &verr) {
+		return verr.Reason
+	}
+	return wire.ReasonInvalidFormat
 }
 
 // checks if a sequence number exists in the database
-func (h *Handler) sequenceNumberExists(seq int) (bool, error) {
+func (h *Handler) sequenceNumberExists(ctx context.Context, namespace string, seq int) (bool, error) {
 	var exists bool
-	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM wire_messages WHERE seq = $1)", seq).Scan(&exists)
+	query := "SELECT EXISTS(SELECT 1 FROM wire_messages WHERE namespace = $1 AND seq = $2)"
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	err := h.db.QueryRowContext(ctx, query, namespace, seq).Scan(&exists)
+	tracing.End(span, err)
 	return exists, err
 }
 
 // posts a wire message to the database
 func (h *Handler) postWireMessage(c *gin.Context) {
+	unmask, ok := unmaskRequested(c)
+	if !ok {
+		return
+	}
+	// negotiate before anything is stored, so a 406 never follows an insert
+	respCodec, ok := h.responseCodec(c)
+	if !ok {
+		return
+	}
+	reqCodec, ok := h.requestCodec(c)
+	if !ok {
+		return
+	}
+
 	message, err := c.GetRawData()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		payloadTooLarge(c, tooLarge.Limit)
+		return
+	}
 	if err != nil {
-		handleError(c, http.StatusBadRequest, "Failed to read message")
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidFormat, "Failed to read message")
 		return
 	}
 
-	// Parse the wire message from the raw string
-	wireMessage, err := parseWireMessage(string(message))
+	// Decode the wire message with the codec for its content type
+	_, decodeSpan := tracing.Start(c.Request.Context(), "codec.Decode")
+	wireMessage, err := reqCodec.Decode(message)
+	tracing.End(decodeSpan, err)
 	if err != nil {
-		handleError(c, http.StatusBadRequest, err.Error())
+		h.metrics.WireRejected(rejectionReason(err))
+		h.audit.Record(c, audit.ActionWireCreate, "", audit.OutcomeFailure, err.Error())
+		problem.Write(c, wireProblem(err))
 		return
 	}
+	// the canonical form keys every account, so it can be masked whatever
+	// the body looked like
+	logging.FromContext(c).Debug("received wire message", "codec", reqCodec.Name(), "message", redact.String(wireMessage.CanonicalMessage))
+
+	// each sender, or channel of senders, numbers its own wires
+	wireMessage.Namespace = h.seqs.namespace(wireMessage.SenderRTN)
+	resource := wireResource(wireMessage.Namespace, wireMessage.Seq)
 
 	// check if the sequence number already exists in the database
-	exists, err := h.sequenceNumberExists(wireMessage.Seq)
+	exists, err := h.sequenceNumberExists(c.Request.Context(), wireMessage.Namespace, wireMessage.Seq)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, fmt.Sprintf("failed to check sequence number: %v", err))
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeFailure, "sequence check failed")
+		problem.Internal(c, "failed to check sequence number", err)
 		return
 	}
 	if exists {
-		handleError(c, http.StatusBadRequest, fmt.Sprintf("duplicate sequence number %d", wireMessage.Seq))
+		h.metrics.WireRejected(reasonDuplicateSeq)
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeFailure, "duplicate sequence number")
+		problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeDuplicateSeq, "A wire message with this sequence number already exists for this sender").
+			WithErrors(problem.FieldError{Pointer: "/seq", Code: problem.CodeDuplicateSeq, Detail: fmt.Sprintf("duplicate sequence number %d", wireMessage.Seq)}))
+		return
+	}
+
+	// record the authenticated caller as the creator
+	wireMessage.CreatedBy = auth.Subject(c)
+
+	// potential sanctions matches are held for compliance review rather than
+	// rejected, so a false positive can still be released
+	_, screenSpan := tracing.Start(c.Request.Context(), "sanctions.Screen")
+	wireMessage.ScreeningHits = h.screener.Screen(wireMessage)
+	tracing.End(screenSpan, nil)
+
+	// the risk rules look back at the earlier wires of both accounts
+	riskCtx, riskSpan := tracing.Start(c.Request.Context(), "rules.Evaluate")
+	decision, err := h.risk.Evaluate(riskCtx, wireHistory{db: h.db, enc: h.enc}, wireMessage)
+	tracing.End(riskSpan, err)
+	if err != nil {
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeFailure, "risk rules failed")
+		problem.Internal(c, "failed to evaluate risk rules", err)
+		return
+	}
+	wireMessage.RiskScore, wireMessage.RuleHits = decision.Score, decision.Hits
+
+	// a rejection stands whatever the screening found
+	wireMessage.Status = decision.Status
+	if len(wireMessage.ScreeningHits) > 0 && wireMessage.Status == models.StatusAccepted {
+		wireMessage.Status = models.StatusHold
+	}
+
+	// the same transfer resubmitted under a new seq would pay twice, so it
+	// waits for someone to release it
+	wireMessage.DuplicateOf, err = h.findDuplicate(c.Request.Context(), wireMessage, h.duplicateWindow)
+	if err != nil {
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeFailure, "duplicate check failed")
+		problem.Internal(c, "failed to check for duplicate wire messages", err)
+		return
+	}
+	if wireMessage.DuplicateOf != nil && wireMessage.Status == models.StatusAccepted {
+		wireMessage.Status = models.StatusSuspectedDuplicate
+	}
+
+	// a wire that overtook an earlier one waits for it, so the sender's wires
+	// are processed in order
+	if h.seqs.holdGaps && wireMessage.Status == models.StatusAccepted {
+		ahead, err := h.aheadOfGap(c.Request.Context(), wireMessage.Namespace, wireMessage.Seq)
+		if err != nil {
+			h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeFailure, "sequence gap check failed")
+			problem.Internal(c, "failed to check for sequence gaps", err)
+			return
+		}
+		if ahead {
+			wireMessage.Status = models.StatusAwaitingSequence
+		}
+	}
+
+	hits, err := encodeHits(wireMessage.ScreeningHits)
+	if err != nil {
+		problem.Internal(c, "failed to encode screening hits", err)
+		return
+	}
+	ruleHits, err := encodeHits(wireMessage.RuleHits)
+	if err != nil {
+		problem.Internal(c, "failed to encode rule hits", err)
+		return
+	}
+
+	// account numbers and the raw and canonical messages are only stored encrypted
+	sealed, err := sealWireFields(h.enc, wireMessage)
+	if err != nil {
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeFailure, "encryption failed")
+		problem.Internal(c, "failed to encrypt wire message", err)
 		return
 	}
 
 	// insert the wire message into the database
-	query := `INSERT INTO wire_messages (seq, sender_rtn, sender_an, receiver_rtn, receiver_an, amount, raw_message) 
-			 VALUES ($1, $2, $3, $4, $5, $6, $7) 
+	query := `INSERT INTO wire_messages (seq, namespace, sender_rtn, sender_an, sender_an_idx, receiver_rtn, receiver_an, receiver_an_idx, amount, raw_message, canonical_message, created_by,
+			 type_subtype, business_function_code, beneficiary_name, beneficiary_address, beneficiary_reference, originator_name, originator_address, remittance_info, status, screening_hits, risk_score, rule_hits, duplicate_of) 
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25) 
 			 RETURNING id, created_at`
-	err = h.db.QueryRow(query, wireMessage.Seq, wireMessage.SenderRTN, wireMessage.SenderAN, wireMessage.ReceiverRTN, wireMessage.ReceiverAN, wireMessage.Amount, wireMessage.RawMessage).Scan(&wireMessage.ID, &wireMessage.CreatedAt)
+	ctx, span := tracing.StartSQL(c.Request.Context(), "INSERT", query)
+	err = h.db.QueryRowContext(ctx, query, wireMessage.Seq, wireMessage.Namespace, wireMessage.SenderRTN, sealed.senderAN, sealed.senderANIdx, wireMessage.ReceiverRTN, sealed.receiverAN, sealed.receiverANIdx, wireMessage.Amount, sealed.rawMessage, sealed.canonicalMessage, wireMessage.CreatedBy,
+		wireMessage.TypeSubtype, wireMessage.BusinessFunctionCode, sealed.beneficiaryName, sealed.beneficiaryAddress, wireMessage.BeneficiaryReference, sealed.originatorName, sealed.originatorAddress, sealed.remittanceInfo, wireMessage.Status, hits, wireMessage.RiskScore, ruleHits, wireMessage.DuplicateOf).Scan(&wireMessage.ID, &wireMessage.CreatedAt)
+	tracing.End(span, err)
 
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, fmt.Sprintf("failed to insert wire message: %v", err))
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeFailure, "insert failed")
+		problem.Internal(c, "failed to insert wire message", err)
 		return
 	}
 
-	c.IndentedJSON(http.StatusCreated, wireMessage)
+	// a rejected wire is kept as a record of the decision, but never processed
+	if wireMessage.Status == models.StatusRejected {
+		h.metrics.WireRejected(reasonRules)
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeFailure,
+			fmt.Sprintf("rejected: risk score %d", decision.Score))
+		logging.FromContext(c).Warn("wire rejected by risk rules", "seq", wireMessage.Seq, "score", decision.Score)
+		p := problem.New(http.StatusUnprocessableEntity, problem.CodeWireRejected,
+			fmt.Sprintf("Wire message scored %d on the risk rules", decision.Score))
+		for _, hit := range decision.Hits {
+			p.WithErrors(problem.FieldError{Code: strings.ToUpper(hit.Type), Detail: hit.Reason})
+		}
+		problem.Write(c, p)
+		return
+	}
+
+	// wires that wait for a decision are counted as held below instead
+	if wireMessage.Status == models.StatusAccepted {
+		h.metrics.WireAccepted(wireMessage.Amount)
+	}
+
+	// this wire may be the one others in its namespace were waiting for; a
+	// failure here is caught by the next sweep, so the wire still stands
+	if h.seqs.holdGaps {
+		if n, err := h.releaseFilledGaps(c.Request.Context(), wireMessage.Namespace); err != nil {
+			logging.FromContext(c).Error("failed to release wires waiting on a sequence gap", "error", err)
+		} else if n > 0 {
+			logging.FromContext(c).Info("released wires whose sequence gap filled", "namespace", wireMessage.Namespace, "count", n)
+		}
+	}
+
+	if wireMessage.DuplicateOf != nil {
+		c.Header("Link", fmt.Sprintf(`</wire-message/%d?namespace=%s>; rel="related"`, *wireMessage.DuplicateOf, url.QueryEscape(wireMessage.Namespace)))
+	}
+
+	// a held wire is stored but not yet accepted for processing
+	status := http.StatusCreated
+	switch wireMessage.Status {
+	case models.StatusHold:
+		status = http.StatusAccepted
+		var reasons []string
+		if n := len(wireMessage.ScreeningHits); n > 0 {
+			h.metrics.WireHeld(holdReasonSanctions)
+			reasons = append(reasons, fmt.Sprintf("%d sanctions hits", n))
+		}
+		if decision.Status == models.StatusHold {
+			h.metrics.WireHeld(holdReasonRules)
+			reasons = append(reasons, fmt.Sprintf("risk score %d", decision.Score))
+		}
+		if wireMessage.DuplicateOf != nil {
+			reasons = append(reasons, "duplicate of "+wireResource(wireMessage.Namespace, *wireMessage.DuplicateOf))
+		}
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeSuccess, "held: "+strings.Join(reasons, ", "))
+		logging.FromContext(c).Warn("wire held for review", "seq", wireMessage.Seq, "reasons", strings.Join(reasons, ", "))
+	case models.StatusSuspectedDuplicate:
+		status = http.StatusAccepted
+		h.metrics.WireHeld(holdReasonDuplicate)
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeSuccess,
+			"suspected duplicate of "+wireResource(wireMessage.Namespace, *wireMessage.DuplicateOf))
+		logging.FromContext(c).Warn("wire suspected to be a duplicate", "seq", wireMessage.Seq, "duplicate_of", *wireMessage.DuplicateOf)
+	case models.StatusAwaitingSequence:
+		status = http.StatusAccepted
+		h.metrics.WireHeld(holdReasonSequence)
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeSuccess, "awaiting an earlier sequence number")
+		logging.FromContext(c).Warn("wire waiting on a sequence gap", "namespace", wireMessage.Namespace, "seq", wireMessage.Seq)
+	default:
+		h.audit.Record(c, audit.ActionWireCreate, resource, audit.OutcomeSuccess, "")
+	}
+
+	if !unmask {
+		renderWire(c, status, respCodec, redact.WireMessage(wireMessage))
+		return
+	}
+	h.auditUnmask(c, resource)
+	renderWire(c, status, respCodec, wireMessage)
 }
 
 // getWireMessages returns a paginated list of wire messages
 func (h *Handler) getWireMessages(c *gin.Context) {
+	unmask, ok := unmaskRequested(c)
+	if !ok {
+		return
+	}
+	cd, ok := h.responseCodec(c)
+	if !ok {
+		return
+	}
+
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil || page < 1 {
-		handleError(c, http.StatusBadRequest, "Invalid page number")
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "page must be a positive integer")
 		return
 	}
 
 	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	if err != nil || limit < 1 {
-		handleError(c, http.StatusBadRequest, "Invalid limit number")
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be a positive integer")
 		return
 	}
 
 	sortColumn := c.DefaultQuery("sort", "seq") // Default sort column
-	validSortColumns := []string{"seq", "sender_rtn", "sender_an", "receiver_rtn", "receiver_an", "amount"}
+	// account numbers are encrypted at rest, so they cannot be sorted on
+	validSortColumns := []string{"seq", "sender_rtn", "receiver_rtn", "amount"}
 
 	// Validate sort column
 	isValidSort := false
@@ -268,16 +636,45 @@ func (h *Handler) getWireMessages(c *gin.Context) {
 		}
 	}
 	if !isValidSort {
-		handleError(c, http.StatusBadRequest, "Invalid sort column")
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "sort must be one of seq, sender_rtn, receiver_rtn or amount")
 		return
 	}
 
+	// account filters match on the blind index rather than the ciphertext
+	var conditions []string
+	var args []interface{}
+	if senderAN := c.Query("sender_an"); senderAN != "" {
+		args = append(args, h.enc.BlindIndex(senderAN))
+		conditions = append(conditions, fmt.Sprintf("sender_an_idx = $%d", len(args)))
+	}
+	if receiverAN := c.Query("receiver_an"); receiverAN != "" {
+		args = append(args, h.enc.BlindIndex(receiverAN))
+		conditions = append(conditions, fmt.Sprintf("receiver_an_idx = $%d", len(args)))
+	}
+	if status := c.Query("status"); status != "" {
+		if !models.IsKnownStatus(status) {
+			handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, fmt.Sprintf("status %q is not a wire status", status))
+			return
+		}
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
 	offset := (page - 1) * limit
-	query := fmt.Sprintf("SELECT * FROM wire_messages ORDER BY %s ASC LIMIT $1 OFFSET $2", sortColumn)
-	rows, err := h.db.Query(query, limit, offset)
+	args = append(args, limit, offset)
+	query := fmt.Sprintf("SELECT %s FROM wire_messages %s ORDER BY %s ASC LIMIT $%d OFFSET $%d",
+		wireMessageColumns, where, sortColumn, len(args)-1, len(args))
+	ctx, span := tracing.StartSQL(c.Request.Context(), "SELECT", query)
+	defer span.End()
+	rows, err := h.db.QueryContext(ctx, query, args...)
 
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, err.Error())
+		tracing.RecordError(span, err)
+		problem.Internal(c, "database query failed", err)
 		return
 	}
 	defer rows.Close()
@@ -286,50 +683,79 @@ func (h *Handler) getWireMessages(c *gin.Context) {
 	var wireMessages []models.WireMessage
 	for rows.Next() {
 		var wm models.WireMessage
-		err := rows.Scan(&wm.ID, &wm.Seq, &wm.SenderRTN, &wm.SenderAN, &wm.ReceiverRTN, &wm.ReceiverAN, &wm.Amount, &wm.RawMessage, &wm.CreatedAt)
+		err := h.scanWireMessage(rows, &wm)
 		if err != nil {
-			handleError(c, http.StatusInternalServerError, err.Error())
+			tracing.RecordError(span, err)
+			problem.Internal(c, "database query failed", err)
 			return
 		}
 		wireMessages = append(wireMessages, wm)
 	}
 
-	if len(wireMessages) == 0 {
+	h.audit.Record(c, audit.ActionWireList, "wire", audit.OutcomeSuccess,
+		fmt.Sprintf("page=%d limit=%d sort=%s returned=%d", page, limit, sortColumn, len(wireMessages)))
+
+	// JSON clients have always been told about an empty page in a message
+	if _, isJSON := cd.(codec.JSON); isJSON && len(wireMessages) == 0 {
 		c.IndentedJSON(http.StatusOK, gin.H{"message": "No wire messages found"})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, wireMessages)
+	if !unmask {
+		renderWires(c, http.StatusOK, cd, redact.WireMessages(wireMessages))
+		return
+	}
+	for _, wm := range wireMessages {
+		h.auditUnmask(c, wireResource(wm.Namespace, wm.Seq))
+	}
+	renderWires(c, http.StatusOK, cd, wireMessages)
 }
 
 // gets a wire message from the database
 func (h *Handler) getWireMessage(c *gin.Context) {
-	var wireMessage models.WireMessage
-	seq := c.Param("seq")
+	unmask, ok := unmaskRequested(c)
+	if !ok {
+		return
+	}
+	cd, ok := h.responseCodec(c)
+	if !ok {
+		return
+	}
 
-	// convert the sequence number to an integer
-	seqNum, err := strconv.Atoi(seq)
+	seq, namespace, ok := wireRef(c)
+	if !ok {
+		return
+	}
+	resource := wireResource(namespace, seq)
+
+	// seqs repeat across namespaces, so the namespace may be needed to tell
+	// wires apart
+	id, err := h.resolveWire(c.Request.Context(), seq, namespace)
 	if err != nil {
-		handleError(c, http.StatusBadRequest, "Invalid sequence number format")
+		h.wireLookupFailed(c, err, audit.ActionWireRead, resource)
 		return
 	}
 
 	// get the wire message from the database
-	query := "SELECT * FROM wire_messages WHERE seq = $1;"
-	err = h.db.QueryRow(query, seqNum).Scan(
-		&wireMessage.ID, &wireMessage.Seq, &wireMessage.SenderRTN,
-		&wireMessage.SenderAN, &wireMessage.ReceiverRTN, &wireMessage.ReceiverAN,
-		&wireMessage.Amount, &wireMessage.RawMessage, &wireMessage.CreatedAt)
+	var wireMessage models.WireMessage
+	query := fmt.Sprintf("SELECT %s FROM wire_messages WHERE id = $1", wireMessageColumns)
+	ctx, span := tracing.StartSQL(c.Request.Context(), "SELECT", query)
+	err = h.scanWireMessage(h.db.QueryRowContext(ctx, query, id), &wireMessage)
+	tracing.End(span, err)
 
-	// if the wire message is not found, return a 404 error
 	if err != nil {
-		if err == sql.ErrNoRows {
-			handleError(c, http.StatusNotFound, "Wire message not found")
-			return
-		}
-		handleError(c, http.StatusInternalServerError, err.Error())
+		h.audit.Record(c, audit.ActionWireRead, resource, audit.OutcomeFailure, "query failed")
+		problem.Internal(c, "database query failed", err)
 		return
 	}
+	resource = wireResource(wireMessage.Namespace, seq)
+
+	h.audit.Record(c, audit.ActionWireRead, resource, audit.OutcomeSuccess, "")
 
-	c.IndentedJSON(http.StatusOK, wireMessage)
+	if !unmask {
+		renderWire(c, http.StatusOK, cd, redact.WireMessage(wireMessage))
+		return
+	}
+	h.auditUnmask(c, resource)
+	renderWire(c, http.StatusOK, cd, wireMessage)
 }
@@ -2,20 +2,35 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"pillar-bank/auth"
+	"pillar-bank/codec"
+	"pillar-bank/config"
+	"pillar-bank/encryption"
+	"pillar-bank/logging"
 	"pillar-bank/models"
+	"pillar-bank/problem"
+	"pillar-bank/ratelimit"
+	"pillar-bank/redact"
+	"pillar-bank/sanctions"
 	"pillar-bank/testdata"
+	"pillar-bank/wire"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupTestDB() *sql.DB {
@@ -28,27 +43,96 @@ func setupTestDB() *sql.DB {
 		log.Fatal(err)
 	}
 
-	// Create table if not exists
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS wire_messages (
-			id SERIAL PRIMARY KEY,
-			seq INTEGER UNIQUE NOT NULL,
-			sender_rtn VARCHAR(9) NOT NULL,
-			sender_an VARCHAR(255) NOT NULL,
-			receiver_rtn VARCHAR(9) NOT NULL,
-			receiver_an VARCHAR(255) NOT NULL,
-			amount INTEGER NOT NULL,
-			raw_message TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
+	// Create or upgrade the schema
+	if err := migrate(db); err != nil {
 		log.Fatal(err)
 	}
 
 	return db
 }
 
+// testEnvelope encrypts with a fixed master key so tests are reproducible
+func testEnvelope() *encryption.Envelope {
+	enc, err := encryption.NewEnvelope(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return enc
+}
+
+// testConfig returns the defaults with the development users
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "test-secret-0123456789abcdef0123456789"
+	cfg.Auth.Users = []config.User{
+		{Username: "user1", Password: "password1", Roles: []string{auth.RoleOperator}},
+		{Username: "user2", Password: "password2", Roles: []string{auth.RoleOperator, auth.RoleAuditor, auth.RoleSupervisor}},
+	}
+	return cfg
+}
+
+// testAuthenticator signs tokens with the test config's secret
+func testAuthenticator(cfg *config.Config) *auth.Authenticator {
+	return auth.NewAuthenticator([]byte(cfg.Auth.JWTSecret), cfg.Auth.TokenTTL)
+}
+
+// asPrincipal authenticates the request as user1 with the given roles
+func asPrincipal(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth.SetPrincipal(c, &auth.Principal{Subject: "user1", Roles: roles, AuthMethod: auth.MethodJWTCookie})
+	}
+}
+
+// asserts that the response is a problem with the given code and returns it
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, code string) problem.Problem {
+	t.Helper()
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, code, p.Code)
+	assert.Equal(t, w.Code, p.Status)
+	return p
+}
+
+// returns a screener over the sample SDN list
+func testScreener(t *testing.T) *sanctions.Screener {
+	list, err := sanctions.LoadFile("sanctions/testdata/sdn.csv")
+	require.NoError(t, err)
+	return sanctions.NewScreener(list, 0.9)
+}
+
+// testHandler stores wires in db with the test keys and screens them
+// against the sample SDN list; tests set any other features they need
+func testHandler(t *testing.T, db *sql.DB) *Handler {
+	return &Handler{db: db, enc: testEnvelope(), codecs: codec.Default(), screener: testScreener(t)}
+}
+
+// do sends a request to router and returns the recorded response. A body
+// is sent as JSON when it is an object and as a wire string otherwise.
+func do(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		contentType := "text/plain"
+		if strings.HasPrefix(body, "{") {
+			contentType = codec.JSONContentType
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// lists the code and pointer of each field error in p
+func violations(p problem.Problem) []testdata.Violation {
+	var out []testdata.Violation
+	for _, fieldErr := range p.Errors {
+		out = append(out, testdata.Violation{Code: fieldErr.Code, Pointer: fieldErr.Pointer})
+	}
+	return out
+}
+
 func cleanTestDB(db *sql.DB) error {
 	_, err := db.Exec("TRUNCATE wire_messages RESTART IDENTITY")
 	return err
@@ -63,9 +147,9 @@ func TestPostWireMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	h := &Handler{db: db}
+	h := &Handler{db: db, enc: testEnvelope(), codecs: codec.Default()}
 	router := gin.Default()
-	router.POST("/wire-messages", h.postWireMessage)
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
 
 	for _, tt := range testdata.ValidMessages {
 		t.Run(tt.Name, func(t *testing.T) {
@@ -83,10 +167,11 @@ func TestPostWireMessage(t *testing.T) {
 			// Rest of the assertions remain the same
 			assert.Equal(t, tt.Expected.Seq, response.Seq, "seq mismatch")
 			assert.Equal(t, tt.Expected.SenderRTN, response.SenderRTN, "senderRTN mismatch")
-			assert.Equal(t, tt.Expected.SenderAN, response.SenderAN, "senderAN mismatch")
+			assert.Equal(t, redact.MaskAccount(tt.Expected.SenderAN), response.SenderAN, "senderAN mismatch")
 			assert.Equal(t, tt.Expected.ReceiverRTN, response.ReceiverRTN, "receiverRTN mismatch")
-			assert.Equal(t, tt.Expected.ReceiverAN, response.ReceiverAN, "receiverAN mismatch")
+			assert.Equal(t, redact.MaskAccount(tt.Expected.ReceiverAN), response.ReceiverAN, "receiverAN mismatch")
 			assert.Equal(t, tt.Expected.Amount, response.Amount, "amount mismatch")
+			assert.Equal(t, "user1", response.CreatedBy, "createdBy mismatch")
 		})
 	}
 
@@ -98,16 +183,19 @@ func TestPostWireMessage(t *testing.T) {
 			w := httptest.NewRecorder()
 			router.ServeHTTP(w, req)
 			assert.Equal(t, http.StatusBadRequest, w.Code)
-			assert.JSONEq(t, tt.ExpectedError, w.Body.String(), "response body mismatch")
+			p := assertProblem(t, w, tt.ExpectedCode)
+			assert.Equal(t, tt.ExpectedErrors, violations(p))
 		})
 	}
 }
 
 func TestGetWireMessage(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	h := &Handler{db: setupTestDB()}
+	h := &Handler{db: setupTestDB(), enc: testEnvelope(), codecs: codec.Default()}
 	router := gin.Default()
 	router.GET("/wire-message/:seq", h.getWireMessage)
+	router.GET("/operator/wire-message/:seq", asPrincipal(auth.RoleOperator), h.getWireMessage)
+	router.GET("/supervisor/wire-message/:seq", asPrincipal(auth.RoleSupervisor), h.getWireMessage)
 
 	t.Run("Get existing wire message", func(t *testing.T) {
 		req, _ := http.NewRequest(http.MethodGet, "/wire-message/2", nil)
@@ -122,25 +210,62 @@ func TestGetWireMessage(t *testing.T) {
 		expectedMessage := testdata.ValidMessages[1].Expected
 		assert.Equal(t, expectedMessage.Seq, response.Seq)
 		assert.Equal(t, expectedMessage.SenderRTN, response.SenderRTN)
-		assert.Equal(t, expectedMessage.SenderAN, response.SenderAN)
+		assert.Equal(t, redact.MaskAccount(expectedMessage.SenderAN), response.SenderAN)
 		assert.Equal(t, expectedMessage.ReceiverRTN, response.ReceiverRTN)
-		assert.Equal(t, expectedMessage.ReceiverAN, response.ReceiverAN)
+		assert.Equal(t, redact.MaskAccount(expectedMessage.ReceiverAN), response.ReceiverAN)
 		assert.Equal(t, expectedMessage.Amount, response.Amount)
 	})
 
+	t.Run("Get unmasked wire message", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/supervisor/wire-message/2?unmask=true", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.WireMessage
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+
+		expectedMessage := testdata.ValidMessages[1]
+		assert.Equal(t, expectedMessage.Expected.SenderAN, response.SenderAN)
+		assert.Equal(t, expectedMessage.Expected.ReceiverAN, response.ReceiverAN)
+		assert.Equal(t, expectedMessage.WireMessage, response.RawMessage)
+	})
+
+	t.Run("Get wire message as text", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/wire-message/2", nil)
+		req.Header.Set("Accept", "text/plain")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		expected := redact.WireMessage(testdata.ValidMessages[1].Expected)
+		assert.Equal(t, wire.Format(expected)+"\n", w.Body.String())
+	})
+
+	t.Run("Unmask without permission", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/operator/wire-message/2?unmask=true", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assertProblem(t, w, problem.CodeInsufficientPermission)
+	})
+
 	t.Run("Get non-existent wire message", func(t *testing.T) {
 		req, _ := http.NewRequest(http.MethodGet, "/wire-message/999", nil)
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusNotFound, w.Code)
-		assert.JSONEq(t, `{"error": "Wire message not found"}`, w.Body.String())
+		assertProblem(t, w, problem.CodeNotFound)
 	})
 }
 
 func TestGetWireMessages(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	h := &Handler{db: setupTestDB()}
+	h := &Handler{db: setupTestDB(), enc: testEnvelope(), codecs: codec.Default()}
 	router := gin.Default()
 	router.GET("/wire-messages", h.getWireMessages)
 
@@ -158,20 +283,46 @@ func TestGetWireMessages(t *testing.T) {
 		for i, msg := range response {
 			assert.Equal(t, testdata.ValidMessages[i].Expected.Seq, msg.Seq)
 			assert.Equal(t, testdata.ValidMessages[i].Expected.SenderRTN, msg.SenderRTN)
-			assert.Equal(t, testdata.ValidMessages[i].Expected.SenderAN, msg.SenderAN)
+			assert.Equal(t, redact.MaskAccount(testdata.ValidMessages[i].Expected.SenderAN), msg.SenderAN)
 			assert.Equal(t, testdata.ValidMessages[i].Expected.ReceiverRTN, msg.ReceiverRTN)
-			assert.Equal(t, testdata.ValidMessages[i].Expected.ReceiverAN, msg.ReceiverAN)
+			assert.Equal(t, redact.MaskAccount(testdata.ValidMessages[i].Expected.ReceiverAN), msg.ReceiverAN)
 			assert.Equal(t, testdata.ValidMessages[i].Expected.Amount, msg.Amount)
 		}
 	})
 
+	t.Run("Filter by sender account", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/wire-messages?sender_an=629385443170308", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response []models.WireMessage
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 2, len(response))
+		for i, msg := range response {
+			assert.Equal(t, testdata.ValidMessages[i+3].Expected.Seq, msg.Seq)
+			assert.Equal(t, redact.MaskAccount("629385443170308"), msg.SenderAN)
+		}
+	})
+
+	t.Run("Sort by encrypted column", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/wire-messages?sort=sender_an", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assertProblem(t, w, problem.CodeInvalidParameter)
+	})
+
 	t.Run("Get invalid page number", func(t *testing.T) {
 		req, _ := http.NewRequest(http.MethodGet, "/wire-messages?page=0&limit=2", nil)
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
-		assert.JSONEq(t, `{"error": "Invalid page number"}`, w.Body.String())
+		assertProblem(t, w, problem.CodeInvalidParameter)
 	})
 
 	t.Run("Get invalid limit number", func(t *testing.T) {
@@ -180,7 +331,7 @@ func TestGetWireMessages(t *testing.T) {
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
-		assert.JSONEq(t, `{"error": "Invalid limit number"}`, w.Body.String())
+		assertProblem(t, w, problem.CodeInvalidParameter)
 	})
 
 	t.Run("Get wire messages page 1 with limit 2", func(t *testing.T) {
@@ -197,9 +348,9 @@ func TestGetWireMessages(t *testing.T) {
 		for i, msg := range response {
 			assert.Equal(t, testdata.ValidMessages[i].Expected.Seq, msg.Seq)
 			assert.Equal(t, testdata.ValidMessages[i].Expected.SenderRTN, msg.SenderRTN)
-			assert.Equal(t, testdata.ValidMessages[i].Expected.SenderAN, msg.SenderAN)
+			assert.Equal(t, redact.MaskAccount(testdata.ValidMessages[i].Expected.SenderAN), msg.SenderAN)
 			assert.Equal(t, testdata.ValidMessages[i].Expected.ReceiverRTN, msg.ReceiverRTN)
-			assert.Equal(t, testdata.ValidMessages[i].Expected.ReceiverAN, msg.ReceiverAN)
+			assert.Equal(t, redact.MaskAccount(testdata.ValidMessages[i].Expected.ReceiverAN), msg.ReceiverAN)
 			assert.Equal(t, testdata.ValidMessages[i].Expected.Amount, msg.Amount)
 		}
 	})
@@ -218,9 +369,9 @@ func TestGetWireMessages(t *testing.T) {
 		for i, msg := range response {
 			assert.Equal(t, testdata.ValidMessages[i+2].Expected.Seq, msg.Seq)
 			assert.Equal(t, testdata.ValidMessages[i+2].Expected.SenderRTN, msg.SenderRTN)
-			assert.Equal(t, testdata.ValidMessages[i+2].Expected.SenderAN, msg.SenderAN)
+			assert.Equal(t, redact.MaskAccount(testdata.ValidMessages[i+2].Expected.SenderAN), msg.SenderAN)
 			assert.Equal(t, testdata.ValidMessages[i+2].Expected.ReceiverRTN, msg.ReceiverRTN)
-			assert.Equal(t, testdata.ValidMessages[i+2].Expected.ReceiverAN, msg.ReceiverAN)
+			assert.Equal(t, redact.MaskAccount(testdata.ValidMessages[i+2].Expected.ReceiverAN), msg.ReceiverAN)
 			assert.Equal(t, testdata.ValidMessages[i+2].Expected.Amount, msg.Amount)
 		}
 	})
@@ -239,18 +390,102 @@ func TestGetWireMessages(t *testing.T) {
 		for i, msg := range response {
 			assert.Equal(t, testdata.ValidMessages[i+4].Expected.Seq, msg.Seq)
 			assert.Equal(t, testdata.ValidMessages[i+4].Expected.SenderRTN, msg.SenderRTN)
-			assert.Equal(t, testdata.ValidMessages[i+4].Expected.SenderAN, msg.SenderAN)
+			assert.Equal(t, redact.MaskAccount(testdata.ValidMessages[i+4].Expected.SenderAN), msg.SenderAN)
 			assert.Equal(t, testdata.ValidMessages[i+4].Expected.ReceiverRTN, msg.ReceiverRTN)
-			assert.Equal(t, testdata.ValidMessages[i+4].Expected.ReceiverAN, msg.ReceiverAN)
+			assert.Equal(t, redact.MaskAccount(testdata.ValidMessages[i+4].Expected.ReceiverAN), msg.ReceiverAN)
 			assert.Equal(t, testdata.ValidMessages[i+4].Expected.Amount, msg.Amount)
 		}
 	})
 }
 
+// tests that a JSON body is accepted. It cleans the table, so it runs after
+// the listing tests, which expect only the text fixtures
+func TestPostWireMessageJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	require.NoError(t, cleanTestDB(db))
+
+	var logs bytes.Buffer
+	h := &Handler{db: db, enc: testEnvelope(), codecs: codec.Default()}
+	router := gin.New()
+	router.Use(logging.RequestID(logging.New(&logs, slog.LevelDebug)))
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
+
+	body := `{"seq": 20, "sender_rtn": "021000021", "sender_an": "537646894897833", "receiver_rtn": "121145307", "receiver_an": "669907820975207", "amount": 3424}`
+	req, _ := http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response models.WireMessage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 20, response.Seq)
+	assert.Equal(t, redact.MaskAccount("537646894897833"), response.SenderAN)
+	// the raw message is synthesized in canonical form
+	canonical := redact.RawMessage("seq=20;sender_rtn=021000021;sender_an=537646894897833;receiver_rtn=121145307;receiver_an=669907820975207;amount=3424")
+	assert.Equal(t, canonical, response.RawMessage)
+	assert.Equal(t, canonical, response.CanonicalMessage)
+
+	// account numbers too short to look like one on their own are still
+	// masked in the debug log of the body, and names are left out of it
+	body = `{"seq": 21, "sender_rtn": "021000021", "sender_an": "12345678", "receiver_rtn": "121145307", "receiver_an": "87654321", "amount": 3424, "beneficiary_name": "Jane Smith"}`
+	req, _ = http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, logs.String(), "sender_an=****5678")
+	assert.NotContains(t, logs.String(), "12345678")
+	assert.NotContains(t, logs.String(), "87654321")
+	assert.Contains(t, logs.String(), "beneficiary_name=[REDACTED]")
+	assert.NotContains(t, logs.String(), "Jane Smith")
+}
+
+// tests that the optional Fedwire fields are stored encrypted. Like the JSON
+// test it cleans the table, so it runs after the listing tests.
+func TestPostWireMessageFedwireFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	require.NoError(t, cleanTestDB(db))
+
+	h := &Handler{db: db, enc: testEnvelope(), codecs: codec.Default()}
+	router := gin.New()
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
+
+	body := "seq=21;sender_rtn=021000021;sender_an=537646894897833;receiver_rtn=121145307;receiver_an=669907820975207;amount=3424" +
+		";type_subtype=1000;business_function_code=CTR;beneficiary_name=Jane Doe;beneficiary_reference=INV-42" +
+		";originator_name=Acme Corp.;originator_address=1 Main St, Springfield IL;remittance_info=Invoice 42"
+	req, _ := http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// the fields survive storage, decrypted
+	var wm models.WireMessage
+	query := "SELECT " + wireMessageColumns + " FROM wire_messages WHERE seq = 21"
+	require.NoError(t, h.scanWireMessage(db.QueryRow(query), &wm))
+	assert.Equal(t, "1000", wm.TypeSubtype)
+	assert.Equal(t, "CTR", wm.BusinessFunctionCode)
+	assert.Equal(t, "Jane Doe", wm.BeneficiaryName)
+	assert.Empty(t, wm.BeneficiaryAddress)
+	assert.Equal(t, "INV-42", wm.BeneficiaryReference)
+	assert.Equal(t, "Acme Corp.", wm.OriginatorName)
+	assert.Equal(t, "1 Main St, Springfield IL", wm.OriginatorAddress)
+	assert.Equal(t, "Invoice 42", wm.RemittanceInfo)
+
+	var storedName string
+	require.NoError(t, db.QueryRow("SELECT beneficiary_name FROM wire_messages WHERE seq = 21").Scan(&storedName))
+	assert.True(t, encryption.IsEncrypted(storedName))
+}
+
 func TestLogin(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-	router.POST("/login", login)
+	cfg := testConfig()
+	h := &Handler{cfg: cfg, auth: testAuthenticator(cfg)}
+	router.POST("/login", h.login)
 
 	t.Run("Valid credentials", func(t *testing.T) {
 		data := bytes.NewBufferString(`username=user1&password=password1`)
@@ -266,6 +501,21 @@ func TestLogin(t *testing.T) {
 		assert.NotEmpty(t, cookie, "Cookie should be set")
 		assert.Equal(t, "token", cookie[0].Name)
 		assert.NotEmpty(t, cookie[0].Value, "Token should be set")
+		assert.Equal(t, http.SameSiteStrictMode, cookie[0].SameSite)
+		assert.True(t, cookie[0].HttpOnly)
+		assert.False(t, cookie[0].Secure, "Cookie should only be secure over TLS")
+		assert.Equal(t, 900, cookie[0].MaxAge, "Cookie should expire with the token")
+		assert.Equal(t, "localhost", cookie[0].Domain)
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		data := bytes.NewBufferString(`username=nobody&password=password1`)
+		req, _ := http.NewRequest(http.MethodPost, "/login", data)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
 
 	t.Run("Invalid credentials", func(t *testing.T) {
@@ -276,7 +526,216 @@ func TestLogin(t *testing.T) {
 		router.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
-		assert.JSONEq(t, `{"error":"Invalid credentials"}`, w.Body.String())
+		assertProblem(t, w, problem.CodeInvalidCredentials)
+	})
+
+}
+
+func TestMe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	authn := testAuthenticator(testConfig())
+	router.GET("/me", authn.AuthenticateMiddleware, me)
+
+	token, err := authn.CreateToken("user1", "operator")
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response auth.Principal
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "user1", response.Subject)
+	assert.Equal(t, []string{"operator"}, response.Roles)
+	assert.Equal(t, auth.MethodJWTCookie, response.AuthMethod)
+}
+
+func TestErrorResponseIncludesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.RequestID(logging.New(io.Discard, slog.LevelInfo)))
+	cfg := testConfig()
+	h := &Handler{cfg: cfg, auth: testAuthenticator(cfg)}
+	router.POST("/login", h.login)
+
+	data := bytes.NewBufferString(`username=user1&password=wrong-password`)
+	req, _ := http.NewRequest(http.MethodPost, "/login", data)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(logging.RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "req-42", w.Header().Get(logging.RequestIDHeader))
+	p := assertProblem(t, w, problem.CodeInvalidCredentials)
+	assert.Equal(t, "req-42", p.RequestID)
+	assert.Equal(t, "/login", p.Instance)
+}
+
+// tests that unsupported media types are refused before any work is done
+func TestWireContentNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{codecs: codec.Default()}
+	router := gin.New()
+	router.GET("/wire-messages", asPrincipal(auth.RoleOperator), h.getWireMessages)
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
+
+	t.Run("Unacceptable response type", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/wire-messages", nil)
+		req.Header.Set("Accept", "application/xml")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assertProblem(t, w, problem.CodeNotAcceptable)
+		assert.Contains(t, w.Header().Values("Vary"), "Accept")
+	})
+
+	t.Run("Unsupported request type", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader("<wire/>"))
+		req.Header.Set("Content-Type", "application/xml")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assertProblem(t, w, problem.CodeUnsupportedMediaType)
+	})
+
+	t.Run("Unknown JSON field", func(t *testing.T) {
+		body := `{"seq": 1, "sender_rtn": "021000021", "sender_an": "1", "receiver_rtn": "121145307", "receiver_an": "1", "amount": 1, "memo": "x"}`
+		req, _ := http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		p := assertProblem(t, w, problem.CodeUnknownField)
+		assert.Equal(t, []testdata.Violation{{Code: problem.CodeUnknownField, Pointer: "/memo"}}, violations(p))
+	})
+
+	t.Run("Invalid message is rejected by the request codec", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader(`{"seq": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assertProblem(t, w, problem.CodeValidationFailed)
 	})
+}
+
+func TestRejectionReason(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"", wire.ReasonInvalidFormat},
+		{"seq=x;sender_rtn=021000021;sender_an=1;receiver_rtn=121145307;receiver_an=1;amount=1", wire.ReasonInvalidSeq},
+		{"seq=1;sender_rtn=0210;sender_an=1;receiver_rtn=121145307;receiver_an=1;amount=1", wire.ReasonInvalidRTN},
+		{"seq=1;sender_rtn=021000021;sender_an=x;receiver_rtn=121145307;receiver_an=1;amount=1", wire.ReasonInvalidAccount},
+		{"seq=1;sender_rtn=021000021;sender_an=1;receiver_rtn=121145307;receiver_an=1;amount=x", wire.ReasonInvalidAmount},
+		{"seq=1;sender_rtn=021000021;sender_an=1;receiver_rtn=121145307;receiver_an=1", wire.ReasonMissingField},
+		{"seq=1;sender_rtn=021000021;sender_an=1;receiver_rtn=121145307;receiver_an=1;amount=1;memo=x", wire.ReasonUnknownField},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			_, err := wire.Parse(tt.message)
+			assert.Error(t, err)
+			assert.Equal(t, tt.expected, rejectionReason(err))
+		})
+	}
+}
 
+// tests that every violation in a message is reported, without a database
+func TestWireProblemReportsEveryError(t *testing.T) {
+	for _, tt := range testdata.InvalidMessages {
+		if tt.ExpectedCode == problem.CodeDuplicateSeq {
+			// only the database knows the seq is taken
+			continue
+		}
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := wire.Parse(tt.WireMessage)
+			assert.Error(t, err)
+
+			p := wireProblem(err)
+			assert.Equal(t, tt.ExpectedCode, p.Code)
+			assert.Equal(t, tt.ExpectedErrors, violations(*p))
+		})
+	}
+
+	for _, tt := range testdata.ValidMessages {
+		_, err := wire.Parse(tt.WireMessage)
+		assert.NoError(t, err, tt.Name)
+	}
+}
+
+func TestCheckKeyMaterial(t *testing.T) {
+	assert.NoError(t, checkKeyMaterial(testEnvelope()))
+	assert.Error(t, checkKeyMaterial(nil))
+}
+
+func TestPostgresRateLimiter(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE rate_limit_buckets")
+	assert.NoError(t, err)
+
+	// two replicas sharing the table share the bucket
+	limit := ratelimit.PerMinute(1, 2)
+	replicaA := ratelimit.NewPostgresStore(db, time.Hour)
+	replicaB := ratelimit.NewPostgresStore(db, time.Hour)
+	ctx := context.Background()
+
+	res, err := replicaA.Take(ctx, "wire_write:principal:user1", limit)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	res, err = replicaB.Take(ctx, "wire_write:principal:user1", limit)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	res, err = replicaA.Take(ctx, "wire_write:principal:user1", limit)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+
+	res, err = replicaB.Take(ctx, "wire_write:principal:user2", limit)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+// tests that buckets left unused until they refill are deleted
+func TestPostgresRateLimiterPrunes(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE rate_limit_buckets")
+	assert.NoError(t, err)
+
+	limit := ratelimit.PerMinute(60, 1)
+	ctx := context.Background()
+
+	_, err = ratelimit.NewPostgresStore(db, time.Hour).Take(ctx, "login:ip:192.0.2.1", limit)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = ratelimit.NewPostgresStore(db, time.Millisecond).Take(ctx, "login:ip:192.0.2.2", limit)
+	require.NoError(t, err)
+
+	var keys []string
+	rows, err := db.Query("SELECT key FROM rate_limit_buckets ORDER BY key")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		require.NoError(t, rows.Scan(&key))
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"login:ip:192.0.2.2"}, keys)
 }
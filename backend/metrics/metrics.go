@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric name
+const namespace = "pillar_bank"
+
+// route label for requests that did not match any route
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the application's Prometheus collectors. Labels are limited
+// to route templates, methods, statuses and fixed reason codes, never to
+// account numbers or sequence numbers. A nil *Metrics records nothing.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	wiresAccepted   prometheus.Counter
+	wiresRejected   *prometheus.CounterVec
+	wiresHeld       *prometheus.CounterVec
+	amountIngested  prometheus.Counter
+	logins          *prometheus.CounterVec
+}
+
+// New creates and registers the application metrics along with the Go
+// runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		wiresAccepted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wire_messages_accepted_total",
+			Help:      "Wire messages accepted, when stored or once released from review.",
+		}),
+		wiresRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wire_messages_rejected_total",
+			Help:      "Wire messages rejected, by validation reason.",
+		}, []string{"reason"}),
+		wiresHeld: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wire_messages_held_total",
+			Help:      "Wire messages stored on hold for review, by reason.",
+		}, []string{"reason"}),
+		amountIngested: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wire_amount_ingested_total",
+			Help:      "Sum of the amounts of accepted wire messages.",
+		}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_attempts_total",
+			Help:      "Login attempts by outcome.",
+		}, []string{"outcome"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.wiresAccepted,
+		m.wiresRejected,
+		m.wiresHeld,
+		m.amountIngested,
+		m.logins,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// RegisterDB exports connection pool statistics from db.Stats()
+func (m *Metrics) RegisterDB(db *sql.DB) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, "pillar_bank"))
+}
+
+// Middleware counts and times every request by its route template, so
+// path parameters such as a wire's seq never become label values
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m == nil {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		m.requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return gin.WrapH(h)
+}
+
+// WireAccepted records a wire accepted, when stored or once released, and
+// its amount; wires stored to wait for a decision are recorded by WireHeld
+func (m *Metrics) WireAccepted(amount int) {
+	if m == nil {
+		return
+	}
+	m.wiresAccepted.Inc()
+	m.amountIngested.Add(float64(amount))
+}
+
+// WireRejected records a wire rejected for reason, which must come from a
+// fixed set of codes
+func (m *Metrics) WireRejected(reason string) {
+	if m == nil {
+		return
+	}
+	m.wiresRejected.WithLabelValues(reason).Inc()
+}
+
+// WireHeld records a wire stored on hold for reason, which must come from a
+// fixed set of codes
+func (m *Metrics) WireHeld(reason string) {
+	if m == nil {
+		return
+	}
+	m.wiresHeld.WithLabelValues(reason).Inc()
+}
+
+// LoginAttempt records the outcome of a login
+func (m *Metrics) LoginAttempt(success bool) {
+	if m == nil {
+		return
+	}
+	outcome := "failure"
+	if success {
+		outcome = "success"
+	}
+	m.logins.WithLabelValues(outcome).Inc()
+}
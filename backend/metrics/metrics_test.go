@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fetches the text exposition from the metrics endpoint
+func scrape(t *testing.T, router *gin.Engine) string {
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/metrics", m.Handler())
+	router.GET("/wire-message/:seq", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/wire-message/123456", "/wire-message/654321", "/nowhere"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	m.WireAccepted(3424)
+	m.WireAccepted(2123)
+	m.WireRejected("invalid_rtn")
+	m.WireHeld("sanctions")
+	m.LoginAttempt(true)
+	m.LoginAttempt(false)
+	m.LoginAttempt(false)
+
+	body := scrape(t, router)
+
+	assert.Contains(t, body, `pillar_bank_http_requests_total{method="GET",route="/wire-message/:seq",status="404"} 2`)
+	assert.Contains(t, body, `pillar_bank_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `pillar_bank_http_request_duration_seconds_count{method="GET",route="/wire-message/:seq",status="404"} 2`)
+	assert.Contains(t, body, `pillar_bank_wire_messages_accepted_total 2`)
+	assert.Contains(t, body, `pillar_bank_wire_amount_ingested_total 5547`)
+	assert.Contains(t, body, `pillar_bank_wire_messages_rejected_total{reason="invalid_rtn"} 1`)
+	assert.Contains(t, body, `pillar_bank_wire_messages_held_total{reason="sanctions"} 1`)
+	assert.Contains(t, body, `pillar_bank_login_attempts_total{outcome="success"} 1`)
+	assert.Contains(t, body, `pillar_bank_login_attempts_total{outcome="failure"} 2`)
+
+	// seq values from the path never become label values
+	assert.NotContains(t, body, "123456")
+	assert.NotContains(t, body, "654321")
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+
+	assert.NotPanics(t, func() {
+		m.WireAccepted(1)
+		m.WireRejected("invalid_seq")
+		m.WireHeld("sanctions")
+		m.LoginAttempt(true)
+		m.RegisterDB(nil)
+	})
+}
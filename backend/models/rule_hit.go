@@ -0,0 +1,11 @@
+package models
+
+// RuleHit is a risk rule that fired for a wire
+type RuleHit struct {
+	// Rule is the name the rule was given in the rules file
+	Rule string `json:"rule"`
+	// Type is the kind of check, such as daily_amount
+	Type   string `json:"type"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// ScreeningHit is a sanctions list entry a wire's party matched
+type ScreeningHit struct {
+	// Field is the wire field that matched, such as beneficiary_name
+	Field string `json:"field"`
+	// EntryID is the entry's ent_num in the SDN list
+	EntryID int    `json:"entry_id"`
+	Name    string `json:"name"`
+	Type    string `json:"type,omitempty"`
+	Program string `json:"program,omitempty"`
+	// Score is the similarity of the match, 1 for an exact one
+	Score float64 `json:"score"`
+}
@@ -2,14 +2,64 @@ package models
 
 import "time"
 
+// statuses a stored wire can be in
+const (
+	// StatusAccepted wires passed every check
+	StatusAccepted = "ACCEPTED"
+	// StatusHold wires wait for compliance to clear or block them
+	StatusHold = "HOLD"
+	// StatusBlocked wires were stopped by compliance
+	StatusBlocked = "BLOCKED"
+	// StatusRejected wires scored too high on the risk rules
+	StatusRejected = "REJECTED"
+	// StatusSuspectedDuplicate wires repeat a recent wire and wait for
+	// someone to release or cancel them
+	StatusSuspectedDuplicate = "SUSPECTED_DUPLICATE"
+	// StatusCancelled wires were confirmed as duplicates
+	StatusCancelled = "CANCELLED"
+	// StatusAwaitingSequence wires arrived while an earlier seq from the
+	// same sender is missing
+	StatusAwaitingSequence = "AWAITING_SEQUENCE"
+)
+
+// IsKnownStatus checks if status is one a wire can be in
+func IsKnownStatus(status string) bool {
+	switch status {
+	case StatusAccepted, StatusHold, StatusBlocked, StatusRejected, StatusSuspectedDuplicate, StatusCancelled, StatusAwaitingSequence:
+		return true
+	}
+	return false
+}
+
 type WireMessage struct {
-	ID          int       `json:"id"`
-	Seq         int       `json:"seq"`
-	SenderRTN   string    `json:"sender_rtn"`
-	SenderAN    string    `json:"sender_an"`
-	ReceiverRTN string    `json:"receiver_rtn"`
-	ReceiverAN  string    `json:"receiver_an"`
-	Amount      int       `json:"amount"`
-	RawMessage  string    `json:"message"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int    `json:"id"`
+	Seq         int    `json:"seq"`
+	Namespace   string `json:"namespace"` // sender_rtn, or its channel, within which seq is unique
+	SenderRTN   string `json:"sender_rtn"`
+	SenderAN    string `json:"sender_an"`
+	ReceiverRTN string `json:"receiver_rtn"`
+	ReceiverAN  string `json:"receiver_an"`
+	Amount      int    `json:"amount"`
+
+	// optional Fedwire fields, empty when the wire does not carry them
+	TypeSubtype          string `json:"type_subtype"`
+	BusinessFunctionCode string `json:"business_function_code"`
+	BeneficiaryName      string `json:"beneficiary_name"`
+	BeneficiaryAddress   string `json:"beneficiary_address"`
+	BeneficiaryReference string `json:"beneficiary_reference"`
+	OriginatorName       string `json:"originator_name"`
+	OriginatorAddress    string `json:"originator_address"`
+	RemittanceInfo       string `json:"remittance_info"`
+
+	Status        string         `json:"status"`
+	ScreeningHits []ScreeningHit `json:"screening_hits,omitempty"`
+	RiskScore     int            `json:"risk_score"`
+	RuleHits      []RuleHit      `json:"rule_hits,omitempty"`
+	// DuplicateOf is the seq of the earlier wire this one appears to repeat
+	DuplicateOf *int `json:"duplicate_of,omitempty"`
+
+	RawMessage       string    `json:"message"`
+	CanonicalMessage string    `json:"canonical_message"`
+	CreatedBy        string    `json:"created_by"`
+	CreatedAt        time.Time `json:"created_at"`
 }
@@ -0,0 +1,154 @@
+package problem
+
+import (
+	"net/http"
+	"strings"
+
+	"pillar-bank/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of every error response (RFC 7807)
+const ContentType = "application/problem+json"
+
+// stable error codes clients can switch on; never change an existing one
+const (
+	CodeInvalidFormat          = "INVALID_FORMAT"
+	CodeInvalidSeq             = "INVALID_SEQ"
+	CodeInvalidRTN             = "INVALID_RTN"
+	CodeInvalidAccount         = "INVALID_ACCOUNT"
+	CodeInvalidAmount          = "INVALID_AMOUNT"
+	CodeDuplicateSeq           = "DUPLICATE_SEQ"
+	CodeAmbiguousSeq           = "AMBIGUOUS_SEQ"
+	CodeMissingField           = "MISSING_FIELD"
+	CodeDuplicateField         = "DUPLICATE_FIELD"
+	CodeUnknownField           = "UNKNOWN_FIELD"
+	CodeEmptyValue             = "EMPTY_VALUE"
+	CodeOutOfOrder             = "OUT_OF_ORDER"
+	CodeInvalidTypeSubtype     = "INVALID_TYPE_SUBTYPE"
+	CodeInvalidBusinessFunc    = "INVALID_BUSINESS_FUNCTION"
+	CodeInvalidCharacters      = "INVALID_CHARACTERS"
+	CodeValueTooLong           = "VALUE_TOO_LONG"
+	CodeValidationFailed       = "VALIDATION_FAILED"
+	CodeInvalidParameter       = "INVALID_PARAMETER"
+	CodeInvalidCredentials     = "INVALID_CREDENTIALS"
+	CodeAuthenticationRequired = "AUTHENTICATION_REQUIRED"
+	CodeInvalidToken           = "INVALID_TOKEN"
+	CodeUnknownClientCert      = "UNKNOWN_CLIENT_CERT"
+	CodeInsufficientPermission = "INSUFFICIENT_PERMISSIONS"
+	CodeCrossSiteRequest       = "CROSS_SITE_REQUEST"
+	CodeRateLimited            = "RATE_LIMITED"
+	CodeNotFound               = "NOT_FOUND"
+	CodeWireNotHeld            = "WIRE_NOT_HELD"
+	CodeWireRejected           = "WIRE_REJECTED"
+	CodeNotSuspectedDuplicate  = "NOT_SUSPECTED_DUPLICATE"
+	CodeNotAcceptable          = "NOT_ACCEPTABLE"
+	CodeUnsupportedMediaType   = "UNSUPPORTED_MEDIA_TYPE"
+	CodePayloadTooLarge        = "PAYLOAD_TOO_LARGE"
+	CodeInternal               = "INTERNAL_ERROR"
+)
+
+// titles summarise each code; they never vary between occurrences
+var titles = map[string]string{
+	CodeInvalidFormat:          "Invalid wire message format",
+	CodeInvalidSeq:             "Invalid sequence number",
+	CodeInvalidRTN:             "Invalid routing number",
+	CodeInvalidAccount:         "Invalid account number",
+	CodeInvalidAmount:          "Invalid amount",
+	CodeDuplicateSeq:           "Duplicate sequence number",
+	CodeAmbiguousSeq:           "Ambiguous sequence number",
+	CodeMissingField:           "Missing field",
+	CodeDuplicateField:         "Duplicate field",
+	CodeUnknownField:           "Unknown field",
+	CodeEmptyValue:             "Empty value",
+	CodeOutOfOrder:             "Field out of order",
+	CodeInvalidTypeSubtype:     "Invalid type/subtype",
+	CodeInvalidBusinessFunc:    "Invalid business function code",
+	CodeInvalidCharacters:      "Invalid characters",
+	CodeValueTooLong:           "Value too long",
+	CodeValidationFailed:       "Wire message failed validation",
+	CodeInvalidParameter:       "Invalid query parameter",
+	CodeInvalidCredentials:     "Invalid credentials",
+	CodeAuthenticationRequired: "Authentication required",
+	CodeInvalidToken:           "Invalid token",
+	CodeUnknownClientCert:      "Unknown client certificate",
+	CodeInsufficientPermission: "Insufficient permissions",
+	CodeCrossSiteRequest:       "Cross-site request rejected",
+	CodeRateLimited:            "Too many requests",
+	CodeNotFound:               "Not found",
+	CodeWireNotHeld:            "Wire message is not on hold",
+	CodeWireRejected:           "Wire message rejected by risk rules",
+	CodeNotSuspectedDuplicate:  "Wire message is not a suspected duplicate",
+	CodeNotAcceptable:          "Not acceptable",
+	CodeUnsupportedMediaType:   "Unsupported media type",
+	CodePayloadTooLarge:        "Request body too large",
+	CodeInternal:               "Internal error",
+}
+
+// detail sent for every internal error; the cause is only logged
+const internalDetail = "An internal error occurred. Quote the request id when reporting it."
+
+// FieldError points at one invalid field of the request
+type FieldError struct {
+	Pointer string `json:"pointer,omitempty"`
+	Code    string `json:"code"`
+	Detail  string `json:"detail"`
+}
+
+// Problem is an RFC 7807 problem details object extended with a stable
+// code, the request id and any field errors
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// New describes a problem with the given status and code
+func New(status int, code, detail string) *Problem {
+	title, ok := titles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return &Problem{
+		Type:   "urn:problem:pillar-bank:" + strings.ReplaceAll(strings.ToLower(code), "_", "-"),
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WithErrors attaches field errors to the problem
+func (p *Problem) WithErrors(errs ...FieldError) *Problem {
+	p.Errors = append(p.Errors, errs...)
+	return p
+}
+
+// Write sends p as the response, filling in the request path and id, and
+// aborts the rest of the chain
+func Write(c *gin.Context, p *Problem) {
+	p.Instance = c.Request.URL.Path
+	p.RequestID = logging.GetRequestID(c)
+
+	// set before rendering so gin keeps it instead of application/json
+	c.Header("Content-Type", ContentType)
+	c.JSON(p.Status, p)
+	c.Abort()
+}
+
+// Abort sends a problem with the given status, code and detail
+func Abort(c *gin.Context, status int, code, detail string) {
+	Write(c, New(status, code, detail))
+}
+
+// Internal logs err and sends a 500 whose detail reveals nothing about it
+func Internal(c *gin.Context, msg string, err error) {
+	logging.FromContext(c).Error(msg, "error", err)
+	Abort(c, http.StatusInternalServerError, CodeInternal, internalDetail)
+}
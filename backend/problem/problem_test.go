@@ -0,0 +1,75 @@
+package problem
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pillar-bank/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	p := New(http.StatusBadRequest, CodeInvalidRTN, "bad rtn")
+	assert.Equal(t, "urn:problem:pillar-bank:invalid-rtn", p.Type)
+	assert.Equal(t, "Invalid routing number", p.Title)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+
+	// unknown codes fall back to the status text
+	p = New(http.StatusTeapot, "SOMETHING_ELSE", "")
+	assert.Equal(t, http.StatusText(http.StatusTeapot), p.Title)
+}
+
+// tests that Write renders problem+json with the path, request id and field errors
+func TestWrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.RequestID(slog.Default()))
+	router.POST("/wire-messages", func(c *gin.Context) {
+		Write(c, New(http.StatusBadRequest, CodeInvalidAmount, "invalid amount").
+			WithErrors(FieldError{Pointer: "/amount", Code: CodeInvalidAmount, Detail: "invalid amount"}))
+	}, func(c *gin.Context) {
+		c.String(http.StatusOK, "not reached")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/wire-messages", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, CodeInvalidAmount, p.Code)
+	assert.Equal(t, "/wire-messages", p.Instance)
+	assert.Equal(t, "req-1", p.RequestID)
+	assert.Equal(t, []FieldError{{Pointer: "/amount", Code: CodeInvalidAmount, Detail: "invalid amount"}}, p.Errors)
+}
+
+// tests that internal errors are logged but never sent to the client
+func TestInternal(t *testing.T) {
+	var buf bytes.Buffer
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.RequestID(slog.New(slog.NewJSONHandler(&buf, nil))))
+	router.GET("/", func(c *gin.Context) {
+		Internal(c, "query failed", errors.New(`pq: relation "wire_messages" does not exist`))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"INTERNAL_ERROR"`)
+	assert.NotContains(t, w.Body.String(), "wire_messages")
+	assert.Contains(t, buf.String(), "wire_messages")
+}
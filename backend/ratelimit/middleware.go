@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pillar-bank/auth"
+	"pillar-bank/logging"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// route groups limited independently of each other
+const (
+	GroupLogin     = "login"
+	GroupWireRead  = "wire_read"
+	GroupWireWrite = "wire_write"
+)
+
+// Limiter applies a token bucket per client to each route group. A nil
+// *Limiter limits nothing.
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+}
+
+// New limits each group in limits, keeping buckets in store
+func New(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// identifies the client a request is counted against: the authenticated
+// principal, or else the peer address. Forwarded headers are ignored since
+// a client could rotate them to dodge its limit.
+func clientKey(c *gin.Context) string {
+	if p, ok := auth.GetPrincipal(c); ok {
+		return "principal:" + p.Subject
+	}
+	return "ip:" + c.RemoteIP()
+}
+
+// Middleware limits requests to the routes in group. Place it after
+// authentication so clients are counted by principal rather than address.
+func (l *Limiter) Middleware(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+		limit, ok := l.limits[group]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		key := clientKey(c)
+		res, err := l.store.Take(c.Request.Context(), group+":"+key, limit)
+		if err != nil {
+			// an unavailable store must not stop wires from being taken
+			logging.FromContext(c).Error("rate limiter unavailable, allowing request", "group", group, "error", err)
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		header.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+		header.Set("RateLimit-Policy", strconv.Itoa(limit.Burst)+";w="+ceilSeconds(seconds(float64(limit.Burst)/limit.Rate)))
+
+		if !res.Allowed {
+			logging.FromContext(c).Warn("rate limit exceeded", "group", group, "client", key)
+			header.Set("Retry-After", ceilSeconds(res.RetryAfter))
+			problem.Abort(c, http.StatusTooManyRequests, problem.CodeRateLimited,
+				"Rate limit exceeded; retry after "+ceilSeconds(res.RetryAfter)+" seconds")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// formats d as whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
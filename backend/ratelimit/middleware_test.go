@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pillar-bank/auth"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore simulates an unreachable shared store
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+// sends a request from addr, authenticated as subject when not empty
+func send(router *gin.Engine, method, path, addr, subject string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.RemoteAddr = addr
+	if subject != "" {
+		req.Header.Set("X-Test-Subject", subject)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func newTestRouter(l *Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	// stands in for AuthenticateMiddleware
+	authenticate := func(c *gin.Context) {
+		if subject := c.GetHeader("X-Test-Subject"); subject != "" {
+			auth.SetPrincipal(c, &auth.Principal{Subject: subject})
+		}
+	}
+
+	router.GET("/wire-messages", authenticate, l.Middleware(GroupWireRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/wire-messages", authenticate, l.Middleware(GroupWireWrite), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return router
+}
+
+func TestMiddleware(t *testing.T) {
+	limits := map[string]Limit{
+		GroupWireRead:  PerMinute(60, 2),
+		GroupWireWrite: PerMinute(6, 1),
+	}
+
+	t.Run("sets headers and refuses once the burst is spent", func(t *testing.T) {
+		router := newTestRouter(New(NewMemoryStore(), limits))
+
+		w := send(router, http.MethodGet, "/wire-messages", "10.0.0.1:1234", "user1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+		assert.Equal(t, "2;w=2", w.Header().Get("RateLimit-Policy"))
+		assert.Empty(t, w.Header().Get("Retry-After"))
+
+		send(router, http.MethodGet, "/wire-messages", "10.0.0.1:1234", "user1")
+		w = send(router, http.MethodGet, "/wire-messages", "10.0.0.1:1234", "user1")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `"code":"RATE_LIMITED"`)
+	})
+
+	t.Run("keys by principal, then by address", func(t *testing.T) {
+		router := newTestRouter(New(NewMemoryStore(), limits))
+
+		assert.Equal(t, http.StatusCreated, send(router, http.MethodPost, "/wire-messages", "10.0.0.1:1", "user1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(router, http.MethodPost, "/wire-messages", "10.0.0.2:1", "user1").Code,
+			"a principal is limited whatever address it uses")
+		assert.Equal(t, http.StatusCreated, send(router, http.MethodPost, "/wire-messages", "10.0.0.1:1", "user2").Code)
+
+		assert.Equal(t, http.StatusCreated, send(router, http.MethodPost, "/wire-messages", "10.0.0.3:1", "").Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(router, http.MethodPost, "/wire-messages", "10.0.0.3:2", "").Code)
+		assert.Equal(t, http.StatusCreated, send(router, http.MethodPost, "/wire-messages", "10.0.0.4:1", "").Code)
+	})
+
+	t.Run("groups are limited separately", func(t *testing.T) {
+		router := newTestRouter(New(NewMemoryStore(), limits))
+
+		send(router, http.MethodPost, "/wire-messages", "10.0.0.1:1", "user1")
+		assert.Equal(t, http.StatusTooManyRequests, send(router, http.MethodPost, "/wire-messages", "10.0.0.1:1", "user1").Code)
+		assert.Equal(t, http.StatusOK, send(router, http.MethodGet, "/wire-messages", "10.0.0.1:1", "user1").Code)
+	})
+
+	t.Run("allows requests when the store fails", func(t *testing.T) {
+		router := newTestRouter(New(failingStore{}, limits))
+
+		w := send(router, http.MethodPost, "/wire-messages", "10.0.0.1:1", "user1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	})
+
+	t.Run("nil limiter", func(t *testing.T) {
+		router := newTestRouter(nil)
+
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusCreated, send(router, http.MethodPost, "/wire-messages", "10.0.0.1:1", "user1").Code)
+		}
+	})
+}
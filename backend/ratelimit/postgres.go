@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"pillar-bank/tracing"
+)
+
+// refills the bucket, creating it full, and returns its tokens
+const refillQuery = `
+	INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+	VALUES ($1, $2, clock_timestamp())
+	ON CONFLICT (key) DO UPDATE SET
+		tokens = LEAST($2, rate_limit_buckets.tokens
+			+ EXTRACT(EPOCH FROM clock_timestamp() - rate_limit_buckets.updated_at) * $3),
+		updated_at = clock_timestamp()
+	RETURNING tokens`
+
+// drops buckets that have not been used for long enough to refill
+const pruneQuery = `DELETE FROM rate_limit_buckets WHERE updated_at < clock_timestamp() - make_interval(secs => $1)`
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every
+// replica shares the same limits
+type PostgresStore struct {
+	db *sql.DB
+	// idle is how long an unused bucket takes to be full again
+	idle time.Duration
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresStore creates a store backed by db that forgets buckets left
+// unused for idle, which should be at least RefillTime of the limits used
+func NewPostgresStore(db *sql.DB, idle time.Duration) *PostgresStore {
+	return &PostgresStore{db: db, idle: idle}
+}
+
+// RefillTime returns how long the slowest of limits takes to refill an
+// empty bucket
+func RefillTime(limits map[string]Limit) time.Duration {
+	var longest time.Duration
+	for _, limit := range limits {
+		if d := seconds(float64(limit.Burst) / limit.Rate); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// deletes refilled buckets at most once per sweepInterval, since a new
+// bucket starts full. Failures are only logged; the next sweep retries.
+func (s *PostgresStore) sweep(ctx context.Context) {
+	s.mu.Lock()
+	now := time.Now()
+	due := now.Sub(s.lastSweep) >= sweepInterval
+	if due {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	ctx, span := tracing.StartSQL(ctx, "DELETE", pruneQuery)
+	_, err := s.db.ExecContext(ctx, pruneQuery, s.idle.Seconds())
+	tracing.End(span, err)
+	if err != nil {
+		slog.Error("failed to prune rate limit buckets", "error", err)
+	}
+}
+
+// Take spends a token from key's bucket. The upsert locks the row, so
+// concurrent takes for the same key from any replica are serialized.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (res Result, err error) {
+	s.sweep(ctx)
+
+	ctx, span := tracing.StartSQL(ctx, "UPSERT", refillQuery)
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	var tokens float64
+	if err := tx.QueryRowContext(ctx, refillQuery, key, limit.Burst, limit.Rate).Scan(&tokens); err != nil {
+		return Result{}, err
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+		if _, err := tx.ExecContext(ctx, "UPDATE rate_limit_buckets SET tokens = $2 WHERE key = $1", key, tokens); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Result{}, err
+	}
+	return result(allowed, tokens, limit), nil
+}
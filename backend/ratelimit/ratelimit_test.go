@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is advanced by hand so refills are deterministic
+type fakeClock struct{ t time.Time }
+
+func (f *fakeClock) now() time.Time          { return f.t }
+func (f *fakeClock) advance(d time.Duration) { f.t = f.t.Add(d) }
+
+func newTestStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore()
+	s.now = clock.now
+	return s, clock
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	limit := PerMinute(60, 3) // one token a second
+
+	t.Run("allows a burst then refuses", func(t *testing.T) {
+		s, _ := newTestStore()
+
+		for remaining := 2; remaining >= 0; remaining-- {
+			res, err := s.Take(ctx, "a", limit)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, remaining, res.Remaining)
+		}
+
+		res, err := s.Take(ctx, "a", limit)
+		require.NoError(t, err)
+		assert.False(t, res.Allowed)
+		assert.Equal(t, 0, res.Remaining)
+		assert.Equal(t, time.Second, res.RetryAfter)
+		assert.Equal(t, 3*time.Second, res.Reset)
+	})
+
+	t.Run("refills over time", func(t *testing.T) {
+		s, clock := newTestStore()
+		for i := 0; i < 3; i++ {
+			s.Take(ctx, "a", limit)
+		}
+
+		clock.advance(1500 * time.Millisecond)
+		res, _ := s.Take(ctx, "a", limit)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 0, res.Remaining)
+
+		res, _ = s.Take(ctx, "a", limit)
+		assert.False(t, res.Allowed)
+		assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+		// never more than the burst
+		clock.advance(time.Hour)
+		res, _ = s.Take(ctx, "a", limit)
+		assert.Equal(t, 2, res.Remaining)
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		s, _ := newTestStore()
+		for i := 0; i < 3; i++ {
+			s.Take(ctx, "a", limit)
+		}
+
+		res, _ := s.Take(ctx, "b", limit)
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("forgets refilled buckets", func(t *testing.T) {
+		s, clock := newTestStore()
+		s.Take(ctx, "a", limit)
+		clock.advance(sweepInterval)
+		s.Take(ctx, "b", limit)
+
+		assert.NotContains(t, s.buckets, "a")
+		assert.Contains(t, s.buckets, "b")
+	})
+}
+
+func TestRefillTime(t *testing.T) {
+	assert.Equal(t, time.Duration(0), RefillTime(nil))
+	assert.Equal(t, 30*time.Second, RefillTime(map[string]Limit{
+		GroupLogin:    PerMinute(10, 5),
+		GroupWireRead: PerMinute(300, 60),
+	}))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"pillar-bank/encryption"
+	"pillar-bank/health"
+)
+
+// how long each readiness check may take before it counts as failed
+const readinessTimeout = 2 * time.Second
+
+// readinessChecks builds the dependency checks behind /readyz
+func readinessChecks(db *sql.DB, enc *encryption.Envelope) *health.Checker {
+	checker := health.NewChecker(readinessTimeout)
+	checker.Add("database", func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+	checker.Add("migrations", func(ctx context.Context) error {
+		return checkMigrations(ctx, db)
+	})
+	checker.Add("key_material", func(ctx context.Context) error {
+		return checkKeyMaterial(enc)
+	})
+	return checker
+}
+
+// checks that a master key is loaded and can seal and open a value
+func checkKeyMaterial(enc *encryption.Envelope) error {
+	if enc == nil {
+		return errors.New("no master key loaded")
+	}
+	sealed, err := enc.Encrypt("readiness", "readyz")
+	if err != nil {
+		return err
+	}
+	opened, err := enc.Decrypt(sealed, "readyz")
+	if err != nil {
+		return err
+	}
+	if opened != "readiness" {
+		return errors.New("key round trip mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package redact
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"pillar-bank/models"
+)
+
+// number of trailing characters left visible by MaskAccount
+const visibleDigits = 4
+
+// replaces names, addresses and remittance details in logs
+const redacted = "[REDACTED]"
+
+var (
+	// sender_an=123 or receiver_an = 123 in the wire string format or a query string
+	keyValueAccount = regexp.MustCompile(`((?:sender|receiver)_an\s*=\s*)([^;&\s\],"']*)`)
+	// "sender_an": "123" in JSON, or \"sender_an\": \"123\" once that JSON is
+	// itself quoted inside a JSON log line
+	jsonAccount = regexp.MustCompile(`(\\?"(?:sender|receiver)_an\\?"\s*:\s*\\?")([^"\\]*)`)
+	// beneficiary_name=Jane Smith and the other party details; the values
+	// may hold spaces, so they run to the next separator or quote
+	keyValueParty = regexp.MustCompile(`((?:(?:beneficiary|originator)_(?:name|address)|remittance_info)\s*=\s*)([^;&"\n]*)`)
+	// the same in JSON, quoted or not
+	jsonParty = regexp.MustCompile(`(\\?"(?:(?:beneficiary|originator)_(?:name|address)|remittance_info)\\?"\s*:\s*\\?")([^"\\]*)`)
+	// any long run of digits; routing numbers (9), amounts and seq are shorter
+	longDigitRun = regexp.MustCompile(`\b\d{10,}\b`)
+)
+
+// MaskAccount replaces all but the last four characters of an account
+// number with asterisks. Values too short to keep anything hidden are masked
+// entirely.
+func MaskAccount(an string) string {
+	if len(an) <= visibleDigits {
+		return strings.Repeat("*", len(an))
+	}
+	return strings.Repeat("*", len(an)-visibleDigits) + an[len(an)-visibleDigits:]
+}
+
+// masks the value captured by the second group of a key/value pattern
+func maskValues(re *regexp.Regexp, s string, mask func(string) string) string {
+	return re.ReplaceAllStringFunc(s, func(match string) string {
+		groups := re.FindStringSubmatch(match)
+		return groups[1] + mask(groups[2])
+	})
+}
+
+// hides a party detail entirely, leaving empty values empty
+func maskParty(v string) string {
+	if v == "" {
+		return v
+	}
+	return redacted
+}
+
+// RawMessage masks the account numbers inside a wire string
+func RawMessage(raw string) string {
+	return maskValues(keyValueAccount, raw, MaskAccount)
+}
+
+// WireMessage returns a copy of wm with account numbers masked
+func WireMessage(wm models.WireMessage) models.WireMessage {
+	wm.SenderAN = MaskAccount(wm.SenderAN)
+	wm.ReceiverAN = MaskAccount(wm.ReceiverAN)
+	wm.RawMessage = RawMessage(wm.RawMessage)
+	wm.CanonicalMessage = RawMessage(wm.CanonicalMessage)
+	return wm
+}
+
+// WireMessages masks every message in the slice
+func WireMessages(wms []models.WireMessage) []models.WireMessage {
+	masked := make([]models.WireMessage, len(wms))
+	for i, wm := range wms {
+		masked[i] = WireMessage(wm)
+	}
+	return masked
+}
+
+// String scrubs anything that looks like an account number out of free text
+// bound for logs: keyed values in wire, query string and JSON form, and any
+// bare run of ten or more digits. Names, addresses and remittance details
+// keyed the same ways are replaced outright.
+func String(s string) string {
+	s = maskValues(keyValueAccount, s, MaskAccount)
+	s = maskValues(jsonAccount, s, MaskAccount)
+	s = maskValues(keyValueParty, s, maskParty)
+	s = maskValues(jsonParty, s, maskParty)
+	return longDigitRun.ReplaceAllStringFunc(s, MaskAccount)
+}
+
+// Writer scrubs account numbers from everything written through it
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w so that log output is passed through String
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write scrubs p and writes it to the underlying writer
+func (rw *Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,129 @@
+package redact
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pillar-bank/testdata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskAccount(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"537646894897833", "***********7833"},
+		{"12345678", "****5678"},
+		{"12345", "*2345"},
+		{"1234", "****"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, MaskAccount(tt.input))
+		})
+	}
+}
+
+func TestWireMessage(t *testing.T) {
+	for _, tt := range testdata.ValidMessages {
+		t.Run(tt.Name, func(t *testing.T) {
+			wm := tt.Expected
+			wm.RawMessage = tt.WireMessage
+
+			masked := WireMessage(wm)
+
+			assert.Equal(t, MaskAccount(tt.Expected.SenderAN), masked.SenderAN)
+			assert.Equal(t, MaskAccount(tt.Expected.ReceiverAN), masked.ReceiverAN)
+			assert.True(t, strings.HasSuffix(masked.SenderAN, tt.Expected.SenderAN[len(tt.Expected.SenderAN)-4:]))
+			assert.NotContains(t, masked.RawMessage, tt.Expected.SenderAN)
+			assert.NotContains(t, masked.RawMessage, tt.Expected.ReceiverAN)
+			assert.Contains(t, masked.RawMessage, "sender_an="+MaskAccount(tt.Expected.SenderAN))
+			assert.Contains(t, masked.RawMessage, "receiver_an="+MaskAccount(tt.Expected.ReceiverAN))
+
+			// routing numbers, amounts and seq are left alone
+			assert.Equal(t, tt.Expected.SenderRTN, masked.SenderRTN)
+			assert.Equal(t, tt.Expected.ReceiverRTN, masked.ReceiverRTN)
+			assert.Equal(t, tt.Expected.Amount, masked.Amount)
+			assert.Contains(t, masked.RawMessage, "sender_rtn="+tt.Expected.SenderRTN)
+
+			// the original is not modified
+			assert.Equal(t, tt.Expected.SenderAN, wm.SenderAN)
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, tt := range testdata.ValidMessages {
+		t.Run(tt.Name, func(t *testing.T) {
+			scrubbed := String("Received message: " + tt.WireMessage)
+			assert.NotContains(t, scrubbed, tt.Expected.SenderAN)
+			assert.NotContains(t, scrubbed, tt.Expected.ReceiverAN)
+			assert.Contains(t, scrubbed, tt.Expected.SenderRTN)
+		})
+	}
+
+	for _, tt := range testdata.InvalidMessages {
+		t.Run(tt.Name, func(t *testing.T) {
+			scrubbed := String(tt.WireMessage)
+			assert.NotContains(t, scrubbed, "sender_an=12345678;")
+			assert.NotContains(t, scrubbed, "receiver_an=87654321;")
+		})
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		scrubbed := String(`{"sender_an": "537646894897833", "receiver_an":"12345678", "amount": 3424}`)
+		assert.Equal(t, `{"sender_an": "***********7833", "receiver_an":"****5678", "amount": 3424}`, scrubbed)
+	})
+
+	t.Run("JSON quoted in a log line", func(t *testing.T) {
+		scrubbed := String(`{"msg":"received","body":"{\"sender_an\": \"12345678\", \"receiver_an\":\"87654321\"}"}`)
+		assert.Equal(t, `{"msg":"received","body":"{\"sender_an\": \"****5678\", \"receiver_an\":\"****4321\"}"}`, scrubbed)
+	})
+
+	t.Run("Query string", func(t *testing.T) {
+		scrubbed := String("GET /wire-messages?sender_an=12345678&page=2")
+		assert.Equal(t, "GET /wire-messages?sender_an=****5678&page=2", scrubbed)
+	})
+
+	t.Run("Party details", func(t *testing.T) {
+		scrubbed := String("seq=1;beneficiary_name=Jane Smith;beneficiary_address=1 Main St, Springfield;" +
+			"originator_name=John O'Brien;originator_address=;remittance_info=Invoice 42;amount=3424")
+		assert.Equal(t, "seq=1;beneficiary_name=[REDACTED];beneficiary_address=[REDACTED];"+
+			"originator_name=[REDACTED];originator_address=;remittance_info=[REDACTED];amount=3424", scrubbed)
+	})
+
+	t.Run("Party details in a quoted log value", func(t *testing.T) {
+		scrubbed := String(`level=DEBUG msg="received wire message" message="seq=1;beneficiary_name=Jane Smith"`)
+		assert.Equal(t, `level=DEBUG msg="received wire message" message="seq=1;beneficiary_name=[REDACTED]"`, scrubbed)
+	})
+
+	t.Run("Party details in JSON", func(t *testing.T) {
+		scrubbed := String(`{"beneficiary_name": "Jane Smith", "remittance_info":"Invoice 42", "amount": 3424}`)
+		assert.Equal(t, `{"beneficiary_name": "[REDACTED]", "remittance_info":"[REDACTED]", "amount": 3424}`, scrubbed)
+
+		scrubbed = String(`{"body":"{\"originator_name\": \"John Doe\", \"originator_address\":\"2 Elm St\"}"}`)
+		assert.Equal(t, `{"body":"{\"originator_name\": \"[REDACTED]\", \"originator_address\":\"[REDACTED]\"}"}`, scrubbed)
+	})
+
+	t.Run("Bare account number", func(t *testing.T) {
+		scrubbed := String("lookup failed for 537646894897833 at 021000021")
+		assert.Equal(t, "lookup failed for ***********7833 at 021000021", scrubbed)
+	})
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	line := "Parts: [seq=1 sender_an=537646894897833 receiver_an=669907820975207]\n"
+	n, err := w.Write([]byte(line))
+
+	assert.NoError(t, err)
+	assert.Equal(t, len(line), n)
+	assert.Equal(t, "Parts: [seq=1 sender_an=***********7833 receiver_an=***********5207]\n", buf.String())
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+
+	"pillar-bank/audit"
+	"pillar-bank/auth"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmaskRequested reports whether the caller asked for full account numbers
+// with ?unmask=true. Callers without the unmask permission get a 403 and ok
+// is false, in which case the handler must stop.
+func unmaskRequested(c *gin.Context) (unmask bool, ok bool) {
+	if c.Query("unmask") != "true" {
+		return false, true
+	}
+
+	principal, authenticated := auth.GetPrincipal(c)
+	if !authenticated || !principal.HasPermission(auth.PermUnmaskAccounts) {
+		handleError(c, http.StatusForbidden, problem.CodeInsufficientPermission, "Your role does not allow unmasking account numbers")
+		return false, false
+	}
+
+	return true, true
+}
+
+// records that account numbers for resource were disclosed in full
+func (h *Handler) auditUnmask(c *gin.Context, resource string) {
+	h.audit.Record(c, audit.ActionWireUnmask, resource, audit.OutcomeSuccess, "")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pillar-bank/audit"
+	"pillar-bank/logging"
+	"pillar-bank/models"
+	"pillar-bank/problem"
+	"pillar-bank/redact"
+	"pillar-bank/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// decisions compliance can take on a held wire
+const (
+	decisionClear = "clear"
+	decisionBlock = "block"
+)
+
+// longest note kept with a decision
+const maxReviewNote = 500
+
+// reviewRequest is the body of a decision on a wire
+type reviewRequest struct {
+	Decision string `json:"decision"`
+	Note     string `json:"note"`
+}
+
+// decisionRule describes the decisions that can be taken on wires waiting in
+// one status
+type decisionRule struct {
+	// action is recorded in the audit trail
+	action string
+	// from is the status a wire must be in to be decided
+	from string
+	// to maps each decision to the status it moves the wire to
+	to map[string]string
+	// problem sent when the wire is not in the from status
+	wrongStatusCode   string
+	wrongStatusDetail string
+	// checkDuplicate sends a wire that would be accepted but is a probable
+	// duplicate on to a supervisor instead
+	checkDuplicate bool
+}
+
+// compliance review of held wires
+var reviewRule = decisionRule{
+	action:            audit.ActionWireReview,
+	from:              models.StatusHold,
+	to:                map[string]string{decisionClear: models.StatusAccepted, decisionBlock: models.StatusBlocked},
+	wrongStatusCode:   problem.CodeWireNotHeld,
+	wrongStatusDetail: "Only wire messages on hold can be reviewed",
+	checkDuplicate:    true,
+}
+
+// getReviewQueue lists the wires on hold, oldest first
+func (h *Handler) getReviewQueue(c *gin.Context) {
+	unmask, ok := unmaskRequested(c)
+	if !ok {
+		return
+	}
+	cd, ok := h.responseCodec(c)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "page must be a positive integer")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 1000 {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and 1000")
+		return
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM wire_messages WHERE status = $1 ORDER BY created_at ASC, id ASC LIMIT $2 OFFSET $3", wireMessageColumns)
+	ctx, span := tracing.StartSQL(c.Request.Context(), "SELECT", query)
+	defer span.End()
+	rows, err := h.db.QueryContext(ctx, query, models.StatusHold, limit, (page-1)*limit)
+	if err != nil {
+		tracing.RecordError(span, err)
+		problem.Internal(c, "database query failed", err)
+		return
+	}
+	defer rows.Close()
+
+	var held []models.WireMessage
+	for rows.Next() {
+		var wm models.WireMessage
+		if err := h.scanWireMessage(rows, &wm); err != nil {
+			tracing.RecordError(span, err)
+			problem.Internal(c, "database query failed", err)
+			return
+		}
+		held = append(held, wm)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(span, err)
+		problem.Internal(c, "database query failed", err)
+		return
+	}
+
+	h.audit.Record(c, audit.ActionWireList, "review-queue", audit.OutcomeSuccess,
+		fmt.Sprintf("page=%d limit=%d returned=%d", page, limit, len(held)))
+
+	if !unmask {
+		renderWires(c, http.StatusOK, cd, redact.WireMessages(held))
+		return
+	}
+	for _, wm := range held {
+		h.auditUnmask(c, wireResource(wm.Namespace, wm.Seq))
+	}
+	renderWires(c, http.StatusOK, cd, held)
+}
+
+// reviewWireMessage clears a held wire, accepting it, or blocks it
+func (h *Handler) reviewWireMessage(c *gin.Context) {
+	h.decideWire(c, reviewRule)
+}
+
+// decideWire moves the wire named by the seq parameter out of rule.from
+// according to the decision in the body
+func (h *Handler) decideWire(c *gin.Context, rule decisionRule) {
+	unmask, ok := unmaskRequested(c)
+	if !ok {
+		return
+	}
+	cd, ok := h.responseCodec(c)
+	if !ok {
+		return
+	}
+
+	seq, namespace, ok := wireRef(c)
+	if !ok {
+		return
+	}
+	resource := wireResource(namespace, seq)
+
+	var req reviewRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "body must be a JSON object with a decision")
+		return
+	}
+	status := rule.to[req.Decision]
+	if status == "" {
+		decisions := make([]string, 0, len(rule.to))
+		for d := range rule.to {
+			decisions = append(decisions, d)
+		}
+		sort.Strings(decisions)
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, "decision must be one of "+strings.Join(decisions, ", "))
+		return
+	}
+	if len(req.Note) > maxReviewNote {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidParameter, fmt.Sprintf("note must be at most %d characters", maxReviewNote))
+		return
+	}
+
+	id, err := h.resolveWire(c.Request.Context(), seq, namespace)
+	if err != nil {
+		h.wireLookupFailed(c, err, rule.action, resource)
+		return
+	}
+
+	// a held wire that is also a probable duplicate still needs a
+	// supervisor's decision once compliance clears it
+	duplicateStatus := status
+	if rule.checkDuplicate && status == models.StatusAccepted {
+		duplicateStatus = models.StatusSuspectedDuplicate
+	}
+
+	// only a wire still waiting can be decided, so two people cannot both
+	// decide the same wire
+	query := fmt.Sprintf(`UPDATE wire_messages SET status = CASE WHEN duplicate_of IS NULL THEN $1 ELSE $4 END
+		WHERE id = $2 AND status = $3 RETURNING %s`, wireMessageColumns)
+	ctx, span := tracing.StartSQL(c.Request.Context(), "UPDATE", query)
+	var wm models.WireMessage
+	err = h.scanWireMessage(h.db.QueryRowContext(ctx, query, status, id, rule.from, duplicateStatus), &wm)
+	if err == sql.ErrNoRows {
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+
+	if err == sql.ErrNoRows {
+		h.audit.Record(c, rule.action, resource, audit.OutcomeFailure, "not "+rule.from)
+		handleError(c, http.StatusConflict, rule.wrongStatusCode, rule.wrongStatusDetail)
+		return
+	}
+	if err != nil {
+		h.audit.Record(c, rule.action, resource, audit.OutcomeFailure, "update failed")
+		problem.Internal(c, "failed to update wire message", err)
+		return
+	}
+
+	// a released wire still waits for any earlier seq that is missing. The
+	// decision is already stored, so if the check fails the wire stays
+	// accepted.
+	if h.seqs.holdGaps && wm.Status == models.StatusAccepted {
+		if err := h.awaitSequence(c.Request.Context(), &wm); err != nil {
+			logging.FromContext(c).Error("failed to check a released wire for sequence gaps", "error", err)
+		}
+	}
+
+	resource = wireResource(wm.Namespace, seq)
+	detail := req.Decision
+	if req.Note != "" {
+		detail += ": " + req.Note
+	}
+	switch wm.Status {
+	case models.StatusAccepted:
+		h.metrics.WireAccepted(wm.Amount)
+	case models.StatusSuspectedDuplicate:
+		detail += "; suspected duplicate of " + wireResource(wm.Namespace, *wm.DuplicateOf)
+	case models.StatusAwaitingSequence:
+		h.metrics.WireHeld(holdReasonSequence)
+		detail += "; awaiting an earlier sequence number"
+	}
+	h.audit.Record(c, rule.action, resource, audit.OutcomeSuccess, detail)
+
+	if !unmask {
+		renderWire(c, http.StatusOK, cd, redact.WireMessage(wm))
+		return
+	}
+	h.auditUnmask(c, resource)
+	renderWire(c, http.StatusOK, cd, wm)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"pillar-bank/auth"
+	"pillar-bank/codec"
+	"pillar-bank/metrics"
+	"pillar-bank/models"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tests that malformed review decisions are refused before the database is touched
+func TestReviewWireMessageValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{codecs: codec.Default()}
+	router := gin.New()
+	router.POST("/review-queue/:seq", asPrincipal(auth.RoleCompliance), h.reviewWireMessage)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		code string
+	}{
+		{"Non-numeric seq", "/review-queue/abc", `{"decision": "clear"}`, problem.CodeInvalidSeq},
+		{"Not JSON", "/review-queue/1", `clear`, problem.CodeInvalidParameter},
+		{"Unknown decision", "/review-queue/1", `{"decision": "approve"}`, problem.CodeInvalidParameter},
+		{"Note too long", "/review-queue/1", `{"decision": "block", "note": "` + strings.Repeat("x", maxReviewNote+1) + `"}`, problem.CodeInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(router, http.MethodPost, tt.path, tt.body)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assertProblem(t, w, tt.code)
+		})
+	}
+}
+
+func TestSanctionsReview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	require.NoError(t, cleanTestDB(db))
+
+	h := testHandler(t, db)
+	h.metrics = metrics.New()
+	router := gin.New()
+	router.GET("/metrics", h.metrics.Handler())
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
+	router.GET("/review-queue", asPrincipal(auth.RoleCompliance), h.getReviewQueue)
+	router.POST("/review-queue/:seq", asPrincipal(auth.RoleCompliance), h.reviewWireMessage)
+
+	const wire = "sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000"
+
+	t.Run("Clean wire is accepted", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages", "seq=30;"+wire+";beneficiary_name=Jane Smith")
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusAccepted, response.Status)
+		assert.Empty(t, response.ScreeningHits)
+	})
+
+	t.Run("Potential match is held", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages", "seq=31;"+wire+";beneficiary_name=Jonathan Doe")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusHold, response.Status)
+		require.Len(t, response.ScreeningHits, 1)
+		assert.Equal(t, 1001, response.ScreeningHits[0].EntryID)
+		assert.Equal(t, "beneficiary_name", response.ScreeningHits[0].Field)
+	})
+
+	t.Run("Listed account is held", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages", "seq=32;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=987654321;amount=1000")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+	})
+
+	t.Run("Held wires are not counted as accepted", func(t *testing.T) {
+		w := do(router, http.MethodGet, "/metrics", "")
+		assert.Contains(t, w.Body.String(), "pillar_bank_wire_messages_accepted_total 1\n")
+		assert.Contains(t, w.Body.String(), "pillar_bank_wire_amount_ingested_total 1000\n")
+		assert.Contains(t, w.Body.String(), `pillar_bank_wire_messages_held_total{reason="sanctions"} 2`)
+	})
+
+	t.Run("Queue lists held wires with their hits", func(t *testing.T) {
+		w := do(router, http.MethodGet, "/review-queue", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var held []models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &held))
+		require.Len(t, held, 2)
+		assert.Equal(t, 31, held[0].Seq)
+		assert.Equal(t, 1001, held[0].ScreeningHits[0].EntryID)
+		assert.Equal(t, 32, held[1].Seq)
+		assert.Equal(t, 1002, held[1].ScreeningHits[0].EntryID)
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/review-queue/31", `{"decision": "clear", "note": "different date of birth"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusAccepted, response.Status)
+		// the hits stay with the wire as a record of what was reviewed
+		assert.Len(t, response.ScreeningHits, 1)
+
+		w = do(router, http.MethodGet, "/metrics", "")
+		assert.Contains(t, w.Body.String(), "pillar_bank_wire_messages_accepted_total 2\n")
+		assert.Contains(t, w.Body.String(), "pillar_bank_wire_amount_ingested_total 2000\n")
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/review-queue/32", `{"decision": "block"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusBlocked, response.Status)
+	})
+
+	t.Run("Wire no longer on hold", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/review-queue/31", `{"decision": "block"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assertProblem(t, w, problem.CodeWireNotHeld)
+	})
+
+	t.Run("Unknown wire", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/review-queue/999", `{"decision": "clear"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assertProblem(t, w, problem.CodeNotFound)
+	})
+
+	t.Run("Queue is empty once reviewed", func(t *testing.T) {
+		w := do(router, http.MethodGet, "/review-queue", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, "[]", w.Body.String())
+	})
+}
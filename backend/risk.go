@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"pillar-bank/encryption"
+	"pillar-bank/models"
+	"pillar-bank/rules"
+	"pillar-bank/tracing"
+
+	"github.com/lib/pq"
+)
+
+// wireHistory answers the risk rules' questions from the stored wires,
+// finding accounts by their blind index since the numbers are encrypted
+type wireHistory struct {
+	db  *sql.DB
+	enc *encryption.Envelope
+}
+
+// statuses of wires that never moved money and never will
+var voidStatuses = pq.Array([]string{models.StatusRejected, models.StatusBlocked, models.StatusCancelled})
+
+// the start of a window of $n seconds, or midnight UTC for rules.Today. The
+// database's clock stamped created_at, so it also decides where windows
+// start, whatever time zone the app runs in.
+const windowStart = `CASE WHEN $%[1]d::float8 = 0
+	THEN date_trunc('day', CURRENT_TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+	ELSE CURRENT_TIMESTAMP - make_interval(secs => $%[1]d::float8) END`
+
+// SenderActivity sums and counts the wires sent by sender within a window
+func (wh wireHistory) SenderActivity(ctx context.Context, sender rules.Account, window time.Duration) (int64, int, error) {
+	query := `SELECT COALESCE(SUM(amount), 0), COUNT(*) FROM wire_messages
+		WHERE sender_rtn = $1 AND sender_an_idx = $2 AND created_at >= ` + fmt.Sprintf(windowStart, 3) + ` AND status <> ALL($4)`
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	var total int64
+	var count int
+	err := wh.db.QueryRowContext(ctx, query, sender.RTN, wh.enc.BlindIndex(sender.AN), window.Seconds(), voidStatuses).Scan(&total, &count)
+	tracing.End(span, err)
+	return total, count, err
+}
+
+// PairSeen reports whether sender has paid receiver before
+func (wh wireHistory) PairSeen(ctx context.Context, sender, receiver rules.Account) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM wire_messages
+		WHERE sender_rtn = $1 AND sender_an_idx = $2 AND receiver_rtn = $3 AND receiver_an_idx = $4 AND status <> ALL($5))`
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	var seen bool
+	err := wh.db.QueryRowContext(ctx, query, sender.RTN, wh.enc.BlindIndex(sender.AN), receiver.RTN, wh.enc.BlindIndex(receiver.AN), voidStatuses).Scan(&seen)
+	tracing.End(span, err)
+	return seen, err
+}
+
+// FanIn counts the accounts other than sender that paid receiver within a
+// window
+func (wh wireHistory) FanIn(ctx context.Context, receiver, sender rules.Account, window time.Duration) (int, error) {
+	query := `SELECT COUNT(DISTINCT (sender_rtn, sender_an_idx)) FROM wire_messages
+		WHERE receiver_rtn = $1 AND receiver_an_idx = $2 AND created_at >= ` + fmt.Sprintf(windowStart, 3) + `
+		AND NOT (sender_rtn = $4 AND sender_an_idx = $5) AND status <> ALL($6)`
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	var count int
+	err := wh.db.QueryRowContext(ctx, query, receiver.RTN, wh.enc.BlindIndex(receiver.AN), window.Seconds(),
+		sender.RTN, wh.enc.BlindIndex(sender.AN), voidStatuses).Scan(&count)
+	tracing.End(span, err)
+	return count, err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pillar-bank/auth"
+	"pillar-bank/models"
+	"pillar-bank/problem"
+	"pillar-bank/rules"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// holds a sender's third wire within the hour and rejects one that takes
+// the day's total over 10000
+const testRules = `
+hold_score: 50
+reject_score: 100
+rules:
+  - {name: burst, type: velocity, score: 50, window: 1h, max_count: 2}
+  - {name: daily-limit, type: daily_amount, score: 100, limit: 10000}
+`
+
+func TestRiskRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	require.NoError(t, cleanTestDB(db))
+
+	engine, err := rules.Load(strings.NewReader(testRules))
+	require.NoError(t, err)
+	h := testHandler(t, db)
+	h.risk = engine
+	router := gin.New()
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
+	router.GET("/wire-message/:seq", asPrincipal(auth.RoleOperator), h.getWireMessage)
+
+	post := func(seq, amount int) *httptest.ResponseRecorder {
+		return do(router, http.MethodPost, "/wire-messages",
+			fmt.Sprintf("seq=%d;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=%d", seq, amount))
+	}
+
+	t.Run("Within limits", func(t *testing.T) {
+		for _, seq := range []int{40, 41} {
+			w := post(seq, 1000)
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			var response models.WireMessage
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, models.StatusAccepted, response.Status)
+			assert.Zero(t, response.RiskScore)
+		}
+	})
+
+	t.Run("Velocity holds", func(t *testing.T) {
+		w := post(42, 1000)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusHold, response.Status)
+		assert.Equal(t, 50, response.RiskScore)
+		require.Len(t, response.RuleHits, 1)
+		assert.Equal(t, "burst", response.RuleHits[0].Rule)
+	})
+
+	t.Run("Daily limit rejects", func(t *testing.T) {
+		w := post(43, 9000)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		p := assertProblem(t, w, problem.CodeWireRejected)
+		require.Len(t, p.Errors, 2)
+		assert.Equal(t, "VELOCITY", p.Errors[0].Code)
+		assert.Equal(t, "DAILY_AMOUNT", p.Errors[1].Code)
+	})
+
+	t.Run("Rejected wire is kept with its decision", func(t *testing.T) {
+		w := do(router, http.MethodGet, "/wire-message/43", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.StatusRejected, response.Status)
+		assert.Equal(t, 150, response.RiskScore)
+		assert.Len(t, response.RuleHits, 2)
+	})
+
+	t.Run("Rejected wires do not count", func(t *testing.T) {
+		// 3000 today plus 7000 is exactly the limit once the rejected 9000 is left out
+		w := post(44, 7000)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		var response models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 50, response.RiskScore)
+	})
+}
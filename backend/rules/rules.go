@@ -0,0 +1,279 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"pillar-bank/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rule types
+const (
+	// TypeDailyAmount limits the total a sender account sends in a UTC day
+	TypeDailyAmount = "daily_amount"
+	// TypeVelocity limits how many wires a sender account sends in a window
+	TypeVelocity = "velocity"
+	// TypeNewPair flags large wires between accounts that have not paid each
+	// other before
+	TypeNewPair = "new_pair"
+	// TypeRoundAmount flags large amounts that are an exact multiple
+	TypeRoundAmount = "round_amount"
+	// TypeFanIn limits how many sender accounts pay one receiver in a window
+	TypeFanIn = "fan_in"
+)
+
+// Account identifies an account by its bank's routing number and the
+// account number
+type Account struct {
+	RTN string
+	AN  string
+}
+
+// Today is the window of the wires stored since midnight UTC, rather than
+// a sliding one
+const Today time.Duration = 0
+
+// History answers questions about previously stored wires. Wires that were
+// rejected, blocked or cancelled never moved money and are not counted.
+// Windows reach back from the store's clock, which also stamped the wires.
+type History interface {
+	// SenderActivity sums the amounts and counts the wires sent by sender
+	// within the window
+	SenderActivity(ctx context.Context, sender Account, window time.Duration) (total int64, count int, err error)
+	// PairSeen reports whether sender has paid receiver before
+	PairSeen(ctx context.Context, sender, receiver Account) (bool, error)
+	// FanIn counts the accounts other than sender that paid receiver within
+	// the window
+	FanIn(ctx context.Context, receiver, sender Account, window time.Duration) (int, error)
+}
+
+// Rule is one check declared in the rules file. Which of the limits apply
+// depends on the type.
+type Rule struct {
+	Name  string `yaml:"name"`
+	Type  string `yaml:"type"`
+	Score int    `yaml:"score"`
+
+	// Limit is the daily total of daily_amount
+	Limit int64 `yaml:"limit"`
+	// Window is the sliding window of velocity and fan_in
+	Window time.Duration `yaml:"window"`
+	// MaxCount is the most wires velocity allows in the window
+	MaxCount int `yaml:"max_count"`
+	// MaxSenders is the most sender accounts fan_in allows in the window
+	MaxSenders int `yaml:"max_senders"`
+	// MinAmount is the smallest amount new_pair and round_amount look at
+	MinAmount int `yaml:"min_amount"`
+	// Multiple is what round_amount considers round
+	Multiple int `yaml:"multiple"`
+}
+
+// file is the layout of a rules file
+type file struct {
+	HoldScore   int    `yaml:"hold_score"`
+	RejectScore int    `yaml:"reject_score"`
+	Rules       []Rule `yaml:"rules"`
+}
+
+// Engine scores wires against a set of rules. A nil *Engine accepts every
+// wire, so the rules can be left unconfigured.
+type Engine struct {
+	holdScore   int
+	rejectScore int
+	rules       []Rule
+}
+
+// Decision is the outcome of evaluating a wire
+type Decision struct {
+	// Status is models.StatusAccepted, StatusHold or StatusRejected
+	Status string
+	// Score is the sum of the scores of the rules that fired
+	Score int
+	Hits  []models.RuleHit
+}
+
+// LoadFile reads a rules file
+func LoadFile(path string) (*Engine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	e, err := Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// Load reads rules declared in YAML. A wire whose rules score at least
+// hold_score is held, and at least reject_score rejected; a reject_score of
+// 0 never rejects.
+func Load(r io.Reader) (*Engine, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return &Engine{holdScore: f.HoldScore, rejectScore: f.RejectScore, rules: f.Rules}, nil
+}
+
+// reports every invalid setting at once
+func (f file) validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if f.HoldScore < 1 {
+		fail("hold_score: must be positive")
+	}
+	if f.RejectScore != 0 && f.RejectScore <= f.HoldScore {
+		fail("reject_score: must be above hold_score, or 0 to never reject")
+	}
+
+	names := map[string]bool{}
+	for i, r := range f.Rules {
+		if r.Name == "" {
+			fail("rules[%d]: name required", i)
+		} else if names[r.Name] {
+			fail("rules[%d]: duplicate name %q", i, r.Name)
+		}
+		names[r.Name] = true
+		if r.Score < 1 {
+			fail("rules[%d]: score must be positive", i)
+		}
+
+		switch r.Type {
+		case TypeDailyAmount:
+			if r.Limit < 1 {
+				fail("rules[%d]: limit must be positive", i)
+			}
+		case TypeVelocity:
+			if r.Window <= 0 || r.MaxCount < 1 {
+				fail("rules[%d]: window and max_count must be positive", i)
+			}
+		case TypeNewPair:
+			if r.MinAmount < 0 {
+				fail("rules[%d]: min_amount must not be negative", i)
+			}
+		case TypeRoundAmount:
+			if r.Multiple < 2 || r.MinAmount < 0 {
+				fail("rules[%d]: multiple must be at least 2 and min_amount not negative", i)
+			}
+		case TypeFanIn:
+			if r.Window <= 0 || r.MaxSenders < 1 {
+				fail("rules[%d]: window and max_senders must be positive", i)
+			}
+		default:
+			fail("rules[%d]: unknown type %q", i, r.Type)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Len returns the number of rules
+func (e *Engine) Len() int {
+	if e == nil {
+		return 0
+	}
+	return len(e.rules)
+}
+
+// Evaluate runs every rule against wm, which is not yet stored, and decides
+// whether to accept, hold or reject it
+func (e *Engine) Evaluate(ctx context.Context, history History, wm models.WireMessage) (Decision, error) {
+	d := Decision{Status: models.StatusAccepted}
+	if e == nil {
+		return d, nil
+	}
+
+	sender := Account{RTN: wm.SenderRTN, AN: wm.SenderAN}
+	receiver := Account{RTN: wm.ReceiverRTN, AN: wm.ReceiverAN}
+
+	for _, r := range e.rules {
+		reason, err := r.check(ctx, history, wm, sender, receiver)
+		if err != nil {
+			return Decision{}, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		if reason == "" {
+			continue
+		}
+		d.Score += r.Score
+		d.Hits = append(d.Hits, models.RuleHit{Rule: r.Name, Type: r.Type, Score: r.Score, Reason: reason})
+	}
+
+	switch {
+	case e.rejectScore > 0 && d.Score >= e.rejectScore:
+		d.Status = models.StatusRejected
+	case d.Score >= e.holdScore:
+		d.Status = models.StatusHold
+	}
+	return d, nil
+}
+
+// returns why the rule fires for wm, or "" when it does not
+func (r Rule) check(ctx context.Context, history History, wm models.WireMessage, sender, receiver Account) (string, error) {
+	switch r.Type {
+	case TypeDailyAmount:
+		total, _, err := history.SenderActivity(ctx, sender, Today)
+		if err != nil {
+			return "", err
+		}
+		if total+int64(wm.Amount) > r.Limit {
+			return fmt.Sprintf("sender total today would be %d, over the limit of %d", total+int64(wm.Amount), r.Limit), nil
+		}
+
+	case TypeVelocity:
+		_, count, err := history.SenderActivity(ctx, sender, r.Window)
+		if err != nil {
+			return "", err
+		}
+		if count+1 > r.MaxCount {
+			return fmt.Sprintf("sender would send %d wires in %s, over the limit of %d", count+1, r.Window, r.MaxCount), nil
+		}
+
+	case TypeNewPair:
+		if wm.Amount < r.MinAmount {
+			return "", nil
+		}
+		seen, err := history.PairSeen(ctx, sender, receiver)
+		if err != nil {
+			return "", err
+		}
+		if !seen {
+			return fmt.Sprintf("first wire from sender to receiver, for %d", wm.Amount), nil
+		}
+
+	case TypeRoundAmount:
+		if wm.Amount >= r.MinAmount && wm.Amount%r.Multiple == 0 {
+			return fmt.Sprintf("amount %d is a multiple of %d", wm.Amount, r.Multiple), nil
+		}
+
+	case TypeFanIn:
+		others, err := history.FanIn(ctx, receiver, sender, r.Window)
+		if err != nil {
+			return "", err
+		}
+		if others+1 > r.MaxSenders {
+			return fmt.Sprintf("receiver would be paid by %d accounts in %s, over the limit of %d", others+1, r.Window, r.MaxSenders), nil
+		}
+	}
+	return "", nil
+}
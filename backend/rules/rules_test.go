@@ -0,0 +1,144 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"pillar-bank/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHistory answers with fixed figures and records the windows asked about
+type fakeHistory struct {
+	total    int64
+	count    int
+	pairSeen bool
+	fanIn    int
+	err      error
+	windows  []time.Duration
+}
+
+func (f *fakeHistory) SenderActivity(_ context.Context, _ Account, window time.Duration) (int64, int, error) {
+	f.windows = append(f.windows, window)
+	return f.total, f.count, f.err
+}
+
+func (f *fakeHistory) PairSeen(context.Context, Account, Account) (bool, error) {
+	return f.pairSeen, f.err
+}
+
+func (f *fakeHistory) FanIn(_ context.Context, _, _ Account, window time.Duration) (int, error) {
+	f.windows = append(f.windows, window)
+	return f.fanIn, f.err
+}
+
+// loads the sample rules
+func testEngine(t *testing.T) *Engine {
+	e, err := LoadFile("testdata/rules.yaml")
+	require.NoError(t, err)
+	return e
+}
+
+func TestLoadFile(t *testing.T) {
+	e := testEngine(t)
+	assert.Equal(t, 5, e.Len())
+	assert.Equal(t, 50, e.holdScore)
+	assert.Equal(t, 100, e.rejectScore)
+	assert.Equal(t, 10*time.Minute, e.rules[1].Window)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected string
+	}{
+		{"Empty", ``, "hold_score: must be positive"},
+		{"Unknown setting", "hold_score: 1\nhold: 2", "field hold not found"},
+		{"Reject below hold", "hold_score: 50\nreject_score: 40", "reject_score: must be above hold_score"},
+		{"Unknown type", "hold_score: 1\nrules: [{name: a, type: geo, score: 1}]", `rules[0]: unknown type "geo"`},
+		{"Duplicate name", "hold_score: 1\nrules: [{name: a, type: new_pair, score: 1}, {name: a, type: new_pair, score: 1}]", `rules[1]: duplicate name "a"`},
+		{"No score", "hold_score: 1\nrules: [{name: a, type: new_pair}]", "rules[0]: score must be positive"},
+		{"No limit", "hold_score: 1\nrules: [{name: a, type: daily_amount, score: 1}]", "rules[0]: limit must be positive"},
+		{"No window", "hold_score: 1\nrules: [{name: a, type: velocity, score: 1, max_count: 3}]", "rules[0]: window and max_count must be positive"},
+		{"Bad multiple", "hold_score: 1\nrules: [{name: a, type: round_amount, score: 1, multiple: 1}]", "rules[0]: multiple must be at least 2"},
+		{"No max_senders", "hold_score: 1\nrules: [{name: a, type: fan_in, score: 1, window: 1h}]", "rules[0]: window and max_senders must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(strings.NewReader(tt.yaml))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	wm := models.WireMessage{SenderRTN: "021000021", SenderAN: "12345678", ReceiverRTN: "121145307", ReceiverAN: "87654321"}
+
+	tests := []struct {
+		name     string
+		amount   int
+		history  fakeHistory
+		status   string
+		score    int
+		expected []string // rule names
+	}{
+		{"Nothing fires", 1234, fakeHistory{pairSeen: true}, models.StatusAccepted, 0, nil},
+		{"Small first wire to a payee", 1234, fakeHistory{}, models.StatusAccepted, 0, nil},
+		{"Round amount alone", 200000, fakeHistory{pairSeen: true}, models.StatusAccepted, 10, []string{"round-amount"}},
+		{"Large round first wire", 200000, fakeHistory{}, models.StatusAccepted, 40, []string{"new-payee", "round-amount"}},
+		{"Over the daily limit", 1234, fakeHistory{total: 999000, pairSeen: true}, models.StatusHold, 60, []string{"daily-limit"}},
+		{"Exactly the daily limit", 1000, fakeHistory{total: 999000, pairSeen: true}, models.StatusAccepted, 0, nil},
+		{"Too many wires", 1234, fakeHistory{count: 5, pairSeen: true}, models.StatusAccepted, 40, []string{"burst"}},
+		{"Fan-in", 1234, fakeHistory{fanIn: 10, pairSeen: true}, models.StatusHold, 50, []string{"mule-account"}},
+		{"Enough to reject", 50000, fakeHistory{total: 999000, count: 5}, models.StatusRejected, 130, []string{"daily-limit", "burst", "new-payee"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wm := wm
+			wm.Amount = tt.amount
+			d, err := testEngine(t).Evaluate(context.Background(), &tt.history, wm)
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, d.Status)
+			assert.Equal(t, tt.score, d.Score)
+
+			var names []string
+			for _, hit := range d.Hits {
+				names = append(names, hit.Rule)
+				assert.NotEmpty(t, hit.Reason)
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestEvaluateWindows(t *testing.T) {
+	history := &fakeHistory{}
+	_, err := testEngine(t).Evaluate(context.Background(), history, models.WireMessage{})
+	require.NoError(t, err)
+
+	// the daily limit counts from midnight UTC, the others slide back
+	assert.Equal(t, []time.Duration{Today, 10 * time.Minute, time.Hour}, history.windows)
+}
+
+func TestEvaluateHistoryError(t *testing.T) {
+	_, err := testEngine(t).Evaluate(context.Background(), &fakeHistory{err: errors.New("connection lost")}, models.WireMessage{})
+	assert.EqualError(t, err, "rule daily-limit: connection lost")
+}
+
+// tests that a nil engine accepts every wire without looking at history
+func TestNilEngine(t *testing.T) {
+	var e *Engine
+	d, err := e.Evaluate(context.Background(), nil, models.WireMessage{Amount: 1 << 30})
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusAccepted, d.Status)
+	assert.Zero(t, e.Len())
+}
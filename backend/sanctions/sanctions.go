@@ -0,0 +1,208 @@
+package sanctions
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pillar-bank/models"
+)
+
+// columns of an OFAC sdn.csv record, which has no header row
+const (
+	colEntNum = iota
+	colName
+	colType
+	colProgram
+	colRemarks = 11
+	numColumns = 12
+)
+
+// marks an empty column in OFAC files
+const null = "-0-"
+
+// account numbers quoted in an entry's remarks, e.g. "Account 0012345678"
+// or "Acct. No. 12-345-678"
+var remarksAccount = regexp.MustCompile(`(?i)\b(?:account|acct\.?)(?:\s+(?:no\.?|number))?\s*:?\s*([0-9][0-9-]{3,}[0-9])`)
+
+// Entry is one record of the SDN list
+type Entry struct {
+	ID       int
+	Name     string
+	Type     string
+	Program  string
+	Accounts []string
+
+	// the name as compared against wire parties
+	normalized string
+}
+
+// List is a loaded SDN list
+type List struct {
+	entries   []Entry
+	byAccount map[string][]int
+}
+
+// LoadFile reads an OFAC sdn.csv file
+func LoadFile(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list, err := Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return list, nil
+}
+
+// Load reads an SDN list in the OFAC sdn.csv format: ent_num, SDN_Name,
+// SDN_Type, Program, Title, Call_Sign, Vess_type, Tonnage, GRT, Vess_flag,
+// Vess_owner and Remarks, with "-0-" for empty columns
+func Load(r io.Reader) (*List, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	list := &List{byAccount: map[string][]int{}}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		// OFAC files end with a DOS end-of-file marker
+		if len(record) == 1 && strings.Trim(record[0], "\x1a \t") == "" {
+			continue
+		}
+		if len(record) != numColumns {
+			return nil, fmt.Errorf("line %d: expected %d columns, got %d", line, numColumns, len(record))
+		}
+
+		id, err := strconv.Atoi(strings.TrimSpace(record[colEntNum]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: ent_num %q is not a number", line, record[colEntNum])
+		}
+		entry := Entry{
+			ID:      id,
+			Name:    column(record, colName),
+			Type:    column(record, colType),
+			Program: column(record, colProgram),
+		}
+		if entry.Name == "" {
+			return nil, fmt.Errorf("line %d: entry %d has no name", line, id)
+		}
+		entry.normalized = normalize(entry.Name)
+		for _, m := range remarksAccount.FindAllStringSubmatch(column(record, colRemarks), -1) {
+			entry.Accounts = append(entry.Accounts, digitsOnly(m[1]))
+		}
+
+		index := len(list.entries)
+		list.entries = append(list.entries, entry)
+		for _, account := range entry.Accounts {
+			list.byAccount[account] = append(list.byAccount[account], index)
+		}
+	}
+	return list, nil
+}
+
+// returns a column with surrounding whitespace and the OFAC null removed
+func column(record []string, i int) string {
+	value := strings.TrimSpace(record[i])
+	if value == null {
+		return ""
+	}
+	return value
+}
+
+// strips separators from an account number
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Len returns the number of entries in the list
+func (l *List) Len() int {
+	return len(l.entries)
+}
+
+// Screener checks wire parties against a list. A nil *Screener finds
+// nothing, so screening can be left unconfigured.
+type Screener struct {
+	list      *List
+	threshold float64
+}
+
+// NewScreener screens against list, reporting names whose similarity is at
+// least threshold, between 0 and 1
+func NewScreener(list *List, threshold float64) *Screener {
+	return &Screener{list: list, threshold: threshold}
+}
+
+// Screen checks the originator and beneficiary of wm: names by fuzzy match
+// and account numbers exactly. Hits are ordered best first.
+func (s *Screener) Screen(wm models.WireMessage) []models.ScreeningHit {
+	if s == nil {
+		return nil
+	}
+
+	var hits []models.ScreeningHit
+	names := []struct{ field, value string }{
+		{"originator_name", wm.OriginatorName},
+		{"beneficiary_name", wm.BeneficiaryName},
+	}
+	for _, name := range names {
+		if name.value == "" {
+			continue
+		}
+		normalized := normalize(name.value)
+		for _, entry := range s.list.entries {
+			if score := similarity(normalized, entry.normalized); score >= s.threshold {
+				hits = append(hits, hit(name.field, entry, score))
+			}
+		}
+	}
+
+	accounts := []struct{ field, value string }{
+		{"sender_an", wm.SenderAN},
+		{"receiver_an", wm.ReceiverAN},
+	}
+	for _, account := range accounts {
+		for _, i := range s.list.byAccount[digitsOnly(account.value)] {
+			hits = append(hits, hit(account.field, s.list.entries[i], 1))
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits
+}
+
+// describes a match of field against entry
+func hit(field string, entry Entry, score float64) models.ScreeningHit {
+	return models.ScreeningHit{
+		Field:   field,
+		EntryID: entry.ID,
+		Name:    entry.Name,
+		Type:    entry.Type,
+		Program: entry.Program,
+		// two decimals are plenty to judge a match by
+		Score: math.Round(score*100) / 100,
+	}
+}
@@ -0,0 +1,129 @@
+package sanctions
+
+import (
+	"strings"
+	"testing"
+
+	"pillar-bank/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile(t *testing.T) {
+	list, err := LoadFile("testdata/sdn.csv")
+	require.NoError(t, err)
+	require.Equal(t, 4, list.Len())
+
+	doe := list.entries[0]
+	assert.Equal(t, 1001, doe.ID)
+	assert.Equal(t, "DOE, Johnathan", doe.Name)
+	assert.Equal(t, "individual", doe.Type)
+	assert.Equal(t, "SDGT", doe.Program)
+	assert.Equal(t, []string{"0012345678"}, doe.Accounts)
+
+	// the OFAC null marker reads as empty
+	assert.Empty(t, list.entries[1].Type)
+	assert.Equal(t, []string{"987654321"}, list.entries[1].Accounts)
+	assert.Empty(t, list.entries[2].Accounts)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		expected string
+	}{
+		{"Too few columns", `1,"DOE, John","individual"`, "line 1: expected 12 columns, got 3"},
+		{"Bad ent_num", `x,"DOE, John",-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- `, `line 1: ent_num "x" is not a number`},
+		{"No name", `1,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- `, "line 1: entry 1 has no name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(strings.NewReader(tt.csv))
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"DOE, Johnathan", "Johnathan Doe", 1, 1},
+		{"DOE, Johnathan", "Jonathan Doe", 0.95, 1},
+		{"ACME SHELL TRADING LLC", "Acme Shell Trading, L.L.C.", 0.9, 1},
+		{"VOLKOV, Ivan Petrovich", "Ivan Volkov", 0.7, 0.9},
+		{"DOE, Johnathan", "Jane Smith", 0, 0.6},
+		{"DOE, Johnathan", "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			score := similarity(normalize(tt.a), normalize(tt.b))
+			assert.GreaterOrEqual(t, score, tt.min)
+			assert.LessOrEqual(t, score, tt.max)
+		})
+	}
+}
+
+func TestScreen(t *testing.T) {
+	list, err := LoadFile("testdata/sdn.csv")
+	require.NoError(t, err)
+	s := NewScreener(list, 0.9)
+
+	clean := models.WireMessage{SenderAN: "12345678", ReceiverAN: "87654321"}
+
+	t.Run("No parties match", func(t *testing.T) {
+		wm := clean
+		wm.OriginatorName = "Jane Smith"
+		wm.BeneficiaryName = "Globex Corporation"
+		assert.Empty(t, s.Screen(wm))
+	})
+
+	t.Run("Misspelled beneficiary", func(t *testing.T) {
+		wm := clean
+		wm.BeneficiaryName = "Jonathan Doe"
+		hits := s.Screen(wm)
+		require.Len(t, hits, 1)
+		assert.Equal(t, "beneficiary_name", hits[0].Field)
+		assert.Equal(t, 1001, hits[0].EntryID)
+		assert.Equal(t, "SDGT", hits[0].Program)
+		assert.Less(t, hits[0].Score, 1.0)
+	})
+
+	t.Run("Listed account", func(t *testing.T) {
+		wm := clean
+		wm.ReceiverAN = "987654321"
+		hits := s.Screen(wm)
+		require.Len(t, hits, 1)
+		assert.Equal(t, models.ScreeningHit{Field: "receiver_an", EntryID: 1002, Name: "ACME SHELL TRADING LLC", Program: "IRAN", Score: 1}, hits[0])
+	})
+
+	t.Run("Best hit first", func(t *testing.T) {
+		wm := clean
+		wm.OriginatorName = "Jonathan Doe"
+		wm.SenderAN = "0012345678"
+		hits := s.Screen(wm)
+		require.Len(t, hits, 2)
+		assert.Equal(t, "sender_an", hits[0].Field)
+		assert.Equal(t, "originator_name", hits[1].Field)
+	})
+
+	t.Run("Threshold", func(t *testing.T) {
+		wm := clean
+		wm.BeneficiaryName = "Ivan Volkov"
+		assert.Empty(t, s.Screen(wm))
+		assert.NotEmpty(t, NewScreener(list, 0.7).Screen(wm))
+	})
+
+	t.Run("Nil screener", func(t *testing.T) {
+		var none *Screener
+		wm := clean
+		wm.BeneficiaryName = "Johnathan Doe"
+		assert.Nil(t, none.Screen(wm))
+	})
+}
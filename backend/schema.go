@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order; a migration's version is its index + 1.
+// Never edit or reorder an applied migration, append a new one instead.
+var migrations = []string{
+	// 1: wire messages table
+	`CREATE TABLE IF NOT EXISTS wire_messages (
+		id SERIAL PRIMARY KEY,
+		seq INTEGER UNIQUE NOT NULL,
+		sender_rtn VARCHAR(9) NOT NULL,
+		sender_an VARCHAR(255) NOT NULL,
+		receiver_rtn VARCHAR(9) NOT NULL,
+		receiver_an VARCHAR(255) NOT NULL,
+		amount INTEGER NOT NULL,
+		raw_message TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	// 2: record who created each wire
+	`ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS created_by VARCHAR(255) NOT NULL DEFAULT ''`,
+	// 3: hash-chained audit trail
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		occurred_at TIMESTAMPTZ NOT NULL,
+		actor VARCHAR(255) NOT NULL,
+		ip VARCHAR(64) NOT NULL,
+		request_id VARCHAR(128) NOT NULL,
+		action VARCHAR(64) NOT NULL,
+		resource VARCHAR(255) NOT NULL,
+		outcome VARCHAR(32) NOT NULL,
+		detail TEXT NOT NULL,
+		prev_hash CHAR(64) NOT NULL,
+		hash CHAR(64) UNIQUE NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor);
+	CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log (action)`,
+	// 4: make the audit trail append-only
+	`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+	DROP TRIGGER IF EXISTS audit_log_no_modify ON audit_log;
+	CREATE TRIGGER audit_log_no_modify BEFORE UPDATE OR DELETE ON audit_log
+		FOR EACH ROW EXECUTE FUNCTION audit_log_append_only()`,
+	// 5: account numbers and raw message are stored encrypted, with blind
+	// indexes for equality lookups
+	`ALTER TABLE wire_messages ALTER COLUMN sender_an TYPE TEXT;
+	ALTER TABLE wire_messages ALTER COLUMN receiver_an TYPE TEXT;
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS sender_an_idx CHAR(64);
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS receiver_an_idx CHAR(64);
+	CREATE INDEX IF NOT EXISTS wire_messages_sender_an_idx ON wire_messages (sender_an_idx);
+	CREATE INDEX IF NOT EXISTS wire_messages_receiver_an_idx ON wire_messages (receiver_an_idx)`,
+	// 6: token buckets shared by every replica's rate limiter
+	`CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+		key VARCHAR(512) PRIMARY KEY,
+		tokens DOUBLE PRECISION NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	)`,
+	// 7: normalized form of each message, stored encrypted like raw_message;
+	// empty for wires accepted before it was introduced
+	`ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS canonical_message TEXT NOT NULL DEFAULT ''`,
+	// 8: optional Fedwire fields, empty when a wire does not carry them;
+	// names, addresses and remittance information are stored encrypted
+	`ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS type_subtype VARCHAR(4) NOT NULL DEFAULT '';
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS business_function_code VARCHAR(3) NOT NULL DEFAULT '';
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS beneficiary_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS beneficiary_address TEXT NOT NULL DEFAULT '';
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS beneficiary_reference VARCHAR(16) NOT NULL DEFAULT '';
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS originator_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS originator_address TEXT NOT NULL DEFAULT '';
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS remittance_info TEXT NOT NULL DEFAULT ''`,
+	// 9: review status and the sanctions list entries a held wire matched,
+	// as a JSON array
+	`ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'ACCEPTED';
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS screening_hits TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS wire_messages_status_idx ON wire_messages (status)`,
+	// 10: risk rule score and hits, and indexes for the rules' look back at
+	// an account's recent wires
+	`ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS risk_score INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS rule_hits TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS wire_messages_sender_activity_idx ON wire_messages (sender_rtn, sender_an_idx, created_at);
+	CREATE INDEX IF NOT EXISTS wire_messages_receiver_activity_idx ON wire_messages (receiver_rtn, receiver_an_idx, created_at)`,
+	// 11: the seq of the earlier wire a suspected duplicate repeats
+	`ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS duplicate_of INTEGER`,
+	// 12: seq is unique per sender namespace rather than globally; existing
+	// wires are namespaced by their sender_rtn
+	`ALTER TABLE wire_messages ADD COLUMN IF NOT EXISTS namespace VARCHAR(64) NOT NULL DEFAULT '';
+	UPDATE wire_messages SET namespace = sender_rtn WHERE namespace = '';
+	ALTER TABLE wire_messages DROP CONSTRAINT IF EXISTS wire_messages_seq_key;
+	CREATE UNIQUE INDEX IF NOT EXISTS wire_messages_namespace_seq_idx ON wire_messages (namespace, seq)`,
+}
+
+// migrate brings the database schema up to date
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	for i, stmt := range migrations {
+		version := i + 1
+
+		var applied bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %d: %w", version, err)
+		}
+		if applied {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checks that every migration has been applied
+func checkMigrations(ctx context.Context, db *sql.DB) error {
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version < len(migrations) {
+		return fmt.Errorf("schema at version %d, want %d", version, len(migrations))
+	}
+	return nil
+}
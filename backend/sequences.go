@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"pillar-bank/audit"
+	"pillar-bank/models"
+	"pillar-bank/problem"
+	"pillar-bank/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// how often wires waiting on a sequence gap are checked for release
+const sequenceSweepInterval = 15 * time.Second
+
+// sequencing decides the namespace each wire is numbered in and whether
+// wires that arrive ahead of a gap wait for it. The zero value numbers each
+// sender_rtn on its own and never holds.
+type sequencing struct {
+	// channels maps routing numbers to the channel they share a sequence in
+	channels   map[string]string
+	holdGaps   bool
+	gapTimeout time.Duration
+}
+
+// namespace returns the namespace of wires sent by senderRTN
+func (s sequencing) namespace(senderRTN string) string {
+	if channel, ok := s.channels[senderRTN]; ok {
+		return channel
+	}
+	return senderRTN
+}
+
+// names a wire in the audit trail
+func wireResource(namespace string, seq int) string {
+	if namespace == "" {
+		return fmt.Sprintf("wire:%d", seq)
+	}
+	return fmt.Sprintf("wire:%s/%d", namespace, seq)
+}
+
+// errAmbiguousSeq is returned when a seq is used in more than one namespace
+// and the request did not say which
+var errAmbiguousSeq = errors.New("sequence number used in more than one namespace")
+
+// reads the seq path parameter and the optional namespace query parameter
+// naming a wire, answering 400 when the seq is not a number
+func wireRef(c *gin.Context) (int, string, bool) {
+	seq, err := strconv.Atoi(c.Param("seq"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, problem.CodeInvalidSeq, "Sequence number must be numeric")
+		return 0, "", false
+	}
+	return seq, c.Query("namespace"), true
+}
+
+// resolveWire returns the id of the wire numbered seq in namespace, or in
+// any namespace when namespace is empty. It returns sql.ErrNoRows when there
+// is no such wire and errAmbiguousSeq when several match.
+func (h *Handler) resolveWire(ctx context.Context, seq int, namespace string) (int, error) {
+	query := "SELECT id FROM wire_messages WHERE seq = $1 AND ($2 = '' OR namespace = $2) LIMIT 2"
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	defer span.End()
+	rows, err := h.db.QueryContext(ctx, query, seq, namespace)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			tracing.RecordError(span, err)
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(span, err)
+		return 0, err
+	}
+
+	switch len(ids) {
+	case 0:
+		return 0, sql.ErrNoRows
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, errAmbiguousSeq
+	}
+}
+
+// answers a failed resolveWire, recording it under action
+func (h *Handler) wireLookupFailed(c *gin.Context, err error, action, resource string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		h.audit.Record(c, action, resource, audit.OutcomeFailure, "not found")
+		handleError(c, http.StatusNotFound, problem.CodeNotFound, "Wire message not found")
+	case errors.Is(err, errAmbiguousSeq):
+		h.audit.Record(c, action, resource, audit.OutcomeFailure, "ambiguous seq")
+		handleError(c, http.StatusConflict, problem.CodeAmbiguousSeq, "More than one sender used this sequence number; give the namespace parameter")
+	default:
+		h.audit.Record(c, action, resource, audit.OutcomeFailure, "query failed")
+		problem.Internal(c, "failed to look up wire message", err)
+	}
+}
+
+// aheadOfGap checks if a seq is missing between the first wire of
+// namespace and seq
+func (h *Handler) aheadOfGap(ctx context.Context, namespace string, seq int) (bool, error) {
+	query := "SELECT COUNT(*), COALESCE(MIN(seq), 0) FROM wire_messages WHERE namespace = $1 AND seq < $2"
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	var below, first int
+	err := h.db.QueryRowContext(ctx, query, namespace, seq).Scan(&below, &first)
+	tracing.End(span, err)
+	if err != nil || below == 0 {
+		return false, err
+	}
+	// seq is unique in a namespace, so with no gap every seq from first up
+	// to seq is taken
+	return below < seq-first, nil
+}
+
+// awaitSequence moves wm, which was just accepted, to AWAITING_SEQUENCE when
+// it is ahead of a gap in its namespace
+func (h *Handler) awaitSequence(ctx context.Context, wm *models.WireMessage) error {
+	ahead, err := h.aheadOfGap(ctx, wm.Namespace, wm.Seq)
+	if err != nil || !ahead {
+		return err
+	}
+
+	query := "UPDATE wire_messages SET status = $1 WHERE id = $2 AND status = $3"
+	ctx, span := tracing.StartSQL(ctx, "UPDATE", query)
+	result, err := h.db.ExecContext(ctx, query, models.StatusAwaitingSequence, wm.ID, models.StatusAccepted)
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	wm.Status = models.StatusAwaitingSequence
+	return nil
+}
+
+// releaseFilledGaps accepts the wires of namespace that were waiting on a
+// gap which has since filled, or of every namespace when namespace is
+// empty, and returns how many it released
+func (h *Handler) releaseFilledGaps(ctx context.Context, namespace string) (int, error) {
+	query := `UPDATE wire_messages w SET status = $1
+		WHERE w.status = $2 AND ($3 = '' OR w.namespace = $3)
+		AND (SELECT COUNT(*) FROM wire_messages x WHERE x.namespace = w.namespace AND x.seq < w.seq)
+			= w.seq - (SELECT MIN(x.seq) FROM wire_messages x WHERE x.namespace = w.namespace)
+		RETURNING w.id, w.namespace, w.seq, w.amount`
+	return h.releaseWires(ctx, "gap filled", query, models.StatusAccepted, models.StatusAwaitingSequence, namespace)
+}
+
+// releaseTimedOut accepts the wires that have waited on a gap for longer
+// than the timeout, and returns how many it released
+func (h *Handler) releaseTimedOut(ctx context.Context) (int, error) {
+	query := `UPDATE wire_messages SET status = $1
+		WHERE status = $2 AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $3)
+		RETURNING id, namespace, seq, amount`
+	return h.releaseWires(ctx, "timed out", query, models.StatusAccepted, models.StatusAwaitingSequence, h.seqs.gapTimeout.Seconds())
+}
+
+// releaseWires runs a release query and records each wire it accepted in
+// the metrics and, as the system actor, in the audit log with detail
+func (h *Handler) releaseWires(ctx context.Context, detail, query string, args ...interface{}) (int, error) {
+	type released struct {
+		id, seq, amount int
+		namespace       string
+	}
+	var wires []released
+	err := func() error {
+		ctx, span := tracing.StartSQL(ctx, "UPDATE", query)
+		defer span.End()
+		rows, err := h.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			tracing.RecordError(span, err)
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var r released
+			if err := rows.Scan(&r.id, &r.namespace, &r.seq, &r.amount); err != nil {
+				tracing.RecordError(span, err)
+				return err
+			}
+			wires = append(wires, r)
+		}
+		if err := rows.Err(); err != nil {
+			tracing.RecordError(span, err)
+			return err
+		}
+		return nil
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	// the wires are accepted whether or not these entries are written
+	for _, r := range wires {
+		h.metrics.WireAccepted(r.amount)
+		_, err := h.audit.Append(ctx, audit.Entry{
+			Actor:    audit.SystemActor,
+			Action:   audit.ActionWireRelease,
+			Resource: wireResource(r.namespace, r.seq),
+			Outcome:  audit.OutcomeSuccess,
+			Detail:   detail,
+		})
+		if err != nil {
+			slog.Error("failed to write audit entry", "action", audit.ActionWireRelease, "wire_id", r.id, "error", err)
+		}
+	}
+	return len(wires), nil
+}
+
+// watchSequenceGaps releases waiting wires every interval until ctx is
+// cancelled. Gaps filled by concurrent requests are caught here, as are
+// gaps that never fill.
+func (h *Handler) watchSequenceGaps(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if n, err := h.releaseFilledGaps(ctx, ""); err != nil {
+			slog.Error("failed to release wires whose sequence gap filled", "error", err)
+		} else if n > 0 {
+			slog.Info("released wires whose sequence gap filled", "count", n)
+		}
+		if n, err := h.releaseTimedOut(ctx); err != nil {
+			slog.Error("failed to release wires waiting on a sequence gap", "error", err)
+		} else if n > 0 {
+			slog.Warn("released wires after waiting on a sequence gap", "count", n, "timeout", h.seqs.gapTimeout.String())
+		}
+	}
+}
+
+// SequenceGap is a run of missing seqs, from and to inclusive
+type SequenceGap struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// OutOfOrder is a wire that arrived after one with a higher seq
+type OutOfOrder struct {
+	Seq int `json:"seq"`
+	// After is the highest seq that had arrived before it
+	After     int       `json:"after"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SequenceReport describes the sequence of one namespace
+type SequenceReport struct {
+	Namespace  string        `json:"namespace"`
+	Count      int           `json:"count"`
+	FirstSeq   int           `json:"first_seq"`
+	LastSeq    int           `json:"last_seq"`
+	Missing    int           `json:"missing"`
+	Awaiting   int           `json:"awaiting"`
+	Gaps       []SequenceGap `json:"gaps"`
+	OutOfOrder []OutOfOrder  `json:"out_of_order"`
+}
+
+// getSequences reports the gaps and out-of-order arrivals of each namespace
+func (h *Handler) getSequences(c *gin.Context) {
+	namespace := c.Query("namespace")
+	ctx := c.Request.Context()
+
+	// the three queries read one snapshot, so every namespace the later two
+	// find is in the summary
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		problem.Internal(c, "database query failed", err)
+		return
+	}
+	defer tx.Rollback()
+
+	reports := map[string]*SequenceReport{}
+	summary := `SELECT namespace, COUNT(*), MIN(seq), MAX(seq), COUNT(*) FILTER (WHERE status = $2)
+		FROM wire_messages WHERE ($1 = '' OR namespace = $1) GROUP BY namespace`
+	err = queryRows(ctx, tx, summary, func(rows *sql.Rows) error {
+		r := &SequenceReport{Gaps: []SequenceGap{}, OutOfOrder: []OutOfOrder{}}
+		if err := rows.Scan(&r.Namespace, &r.Count, &r.FirstSeq, &r.LastSeq, &r.Awaiting); err != nil {
+			return err
+		}
+		r.Missing = r.LastSeq - r.FirstSeq + 1 - r.Count
+		reports[r.Namespace] = r
+		return nil
+	}, namespace, models.StatusAwaitingSequence)
+
+	if err == nil {
+		gaps := `SELECT namespace, seq + 1, next_seq - 1 FROM (
+			SELECT namespace, seq, LEAD(seq) OVER (PARTITION BY namespace ORDER BY seq) AS next_seq
+			FROM wire_messages WHERE ($1 = '' OR namespace = $1)) s
+			WHERE next_seq > seq + 1 ORDER BY namespace, seq`
+		err = queryRows(ctx, tx, gaps, func(rows *sql.Rows) error {
+			var ns string
+			var gap SequenceGap
+			if err := rows.Scan(&ns, &gap.From, &gap.To); err != nil {
+				return err
+			}
+			reports[ns].Gaps = append(reports[ns].Gaps, gap)
+			return nil
+		}, namespace)
+	}
+
+	if err == nil {
+		// arrival order is insertion order
+		outOfOrder := `SELECT namespace, seq, prior_max, created_at FROM (
+			SELECT namespace, seq, created_at, id, MAX(seq) OVER (PARTITION BY namespace ORDER BY id
+				ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS prior_max
+			FROM wire_messages WHERE ($1 = '' OR namespace = $1)) s
+			WHERE seq < prior_max ORDER BY namespace, id`
+		err = queryRows(ctx, tx, outOfOrder, func(rows *sql.Rows) error {
+			var ns string
+			var o OutOfOrder
+			if err := rows.Scan(&ns, &o.Seq, &o.After, &o.CreatedAt); err != nil {
+				return err
+			}
+			reports[ns].OutOfOrder = append(reports[ns].OutOfOrder, o)
+			return nil
+		}, namespace)
+	}
+
+	if err != nil {
+		problem.Internal(c, "database query failed", err)
+		return
+	}
+
+	list := make([]SequenceReport, 0, len(reports))
+	for _, r := range reports {
+		list = append(list, *r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Namespace < list[j].Namespace })
+
+	h.audit.Record(c, audit.ActionWireList, "sequences", audit.OutcomeSuccess, fmt.Sprintf("namespace=%q returned=%d", namespace, len(list)))
+	c.IndentedJSON(http.StatusOK, list)
+}
+
+// runs query in tx and calls scan for each row
+func queryRows(ctx context.Context, tx *sql.Tx, query string, scan func(*sql.Rows) error, args ...interface{}) error {
+	ctx, span := tracing.StartSQL(ctx, "SELECT", query)
+	defer span.End()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			tracing.RecordError(span, err)
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	return nil
+}
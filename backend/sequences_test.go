@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pillar-bank/audit"
+	"pillar-bank/auth"
+	"pillar-bank/models"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequencingNamespace(t *testing.T) {
+	s := sequencing{channels: map[string]string{"021000089": "partner-a"}}
+	assert.Equal(t, "partner-a", s.namespace("021000089"))
+	assert.Equal(t, "021000021", s.namespace("021000021"))
+	assert.Equal(t, "021000021", sequencing{}.namespace("021000021"))
+}
+
+func TestWireResource(t *testing.T) {
+	assert.Equal(t, "wire:021000021/7", wireResource("021000021", 7))
+	assert.Equal(t, "wire:7", wireResource("", 7))
+}
+
+func TestSequences(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	require.NoError(t, cleanTestDB(db))
+
+	h := testHandler(t, db)
+	h.seqs = sequencing{
+		channels:   map[string]string{"021000089": "partner-a", "026009593": "partner-a"},
+		holdGaps:   true,
+		gapTimeout: time.Hour,
+	}
+	h.audit = audit.NewLog(db)
+	start := time.Now()
+	router := gin.New()
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
+	router.GET("/wire-message/:seq", asPrincipal(auth.RoleOperator), h.getWireMessage)
+	router.GET("/sequences", asPrincipal(auth.RoleOperator), h.getSequences)
+	router.POST("/review-queue/:seq", asPrincipal(auth.RoleCompliance), h.reviewWireMessage)
+
+	post := func(seq, senderRTN string) *httptest.ResponseRecorder {
+		return do(router, http.MethodPost, "/wire-messages",
+			"seq="+seq+";sender_rtn="+senderRTN+";sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount="+seq)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		return do(router, http.MethodGet, path, "")
+	}
+	status := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var wm models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &wm))
+		return wm.Status
+	}
+
+	t.Run("Seq is unique per sender", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, post("60", "021000021").Code)
+		assert.Equal(t, http.StatusCreated, post("60", "121000248").Code)
+	})
+
+	t.Run("Ambiguous seq needs a namespace", func(t *testing.T) {
+		w := get("/wire-message/60")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assertProblem(t, w, problem.CodeAmbiguousSeq)
+
+		w = get("/wire-message/60?namespace=121000248")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var wm models.WireMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &wm))
+		assert.Equal(t, "121000248", wm.SenderRTN)
+		assert.Equal(t, "121000248", wm.Namespace)
+	})
+
+	t.Run("Channel shares one sequence", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, post("70", "021000089").Code)
+		w := post("70", "026009593")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assertProblem(t, w, problem.CodeDuplicateSeq)
+	})
+
+	t.Run("Wire ahead of a gap waits", func(t *testing.T) {
+		w := post("62", "021000021")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, models.StatusAwaitingSequence, status(t, w))
+	})
+
+	t.Run("Filling the gap releases it", func(t *testing.T) {
+		w := post("61", "021000021")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, models.StatusAccepted, status(t, get("/wire-message/62?namespace=021000021")))
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		assert.Equal(t, http.StatusAccepted, post("64", "021000021").Code)
+
+		w := get("/sequences?namespace=021000021")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var reports []SequenceReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reports))
+		require.Len(t, reports, 1)
+
+		r := reports[0]
+		assert.Equal(t, "021000021", r.Namespace)
+		assert.Equal(t, 4, r.Count)
+		assert.Equal(t, 60, r.FirstSeq)
+		assert.Equal(t, 64, r.LastSeq)
+		assert.Equal(t, 1, r.Missing)
+		assert.Equal(t, 1, r.Awaiting)
+		assert.Equal(t, []SequenceGap{{From: 63, To: 63}}, r.Gaps)
+		require.Len(t, r.OutOfOrder, 1)
+		assert.Equal(t, 61, r.OutOfOrder[0].Seq)
+		assert.Equal(t, 62, r.OutOfOrder[0].After)
+	})
+
+	t.Run("Waiting times out", func(t *testing.T) {
+		h.seqs.gapTimeout = time.Millisecond
+		time.Sleep(10 * time.Millisecond)
+		released, err := h.releaseTimedOut(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, released)
+		assert.Equal(t, models.StatusAccepted, status(t, get("/wire-message/64?namespace=021000021")))
+	})
+
+	t.Run("Releases are audited", func(t *testing.T) {
+		entries, err := h.audit.Query(context.Background(), audit.Filter{Action: audit.ActionWireRelease, From: start})
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, audit.SystemActor, entries[0].Actor)
+		assert.Equal(t, "wire:021000021/62", entries[0].Resource)
+		assert.Equal(t, "gap filled", entries[0].Detail)
+		assert.Equal(t, "wire:021000021/64", entries[1].Resource)
+		assert.Equal(t, "timed out", entries[1].Detail)
+	})
+
+	t.Run("Cleared hold ahead of a gap waits", func(t *testing.T) {
+		w := do(router, http.MethodPost, "/wire-messages",
+			"seq=63;sender_rtn=121000248;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=63;beneficiary_name=Jonathan Doe")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, models.StatusHold, status(t, w))
+
+		w = do(router, http.MethodPost, "/review-queue/63?namespace=121000248", `{"decision": "clear"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, models.StatusAwaitingSequence, status(t, w))
+	})
+}
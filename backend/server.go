@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// server timeouts; writeTimeout also bounds the slowest handler
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 15 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = 60 * time.Second
+)
+
+// how long shutdown waits for in-flight requests before giving up on them
+const drainTimeout = 25 * time.Second
+
+// how long shutdown waits for background workers to flush
+const flushTimeout = 5 * time.Second
+
+// newServer wraps handler in a server with read, write and idle timeouts
+func newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// serve accepts connections on ln until ctx is cancelled, then stops
+// accepting new connections and waits up to drain for in-flight requests
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, drain time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining in-flight requests", "timeout", drain.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+
+	if err := srv.Shutdown(drainCtx); err != nil {
+		return fmt.Errorf("failed to drain in-flight requests: %w", err)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// limitBody rejects request bodies over max bytes with 413. Bodies that
+// declare their length are turned away before they are read; the rest fail
+// when a handler reads past the limit.
+func limitBody(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > max {
+			payloadTooLarge(c, max)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		c.Next()
+	}
+}
+
+// answers 413 for a body over limit bytes
+func payloadTooLarge(c *gin.Context, limit int64) {
+	handleError(c, http.StatusRequestEntityTooLarge, problem.CodePayloadTooLarge, fmt.Sprintf("Request body must be at most %d bytes", limit))
+}
+
+// waits for the background workers, whose context must already be
+// cancelled, then closes the database they may still be using
+func shutdown(db *sql.DB, workers *sync.WaitGroup, flushTracing func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Error("background workers did not stop in time", "timeout", flushTimeout.String())
+	}
+
+	if err := flushTracing(ctx); err != nil {
+		slog.Error("failed to flush spans", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
+	}
+	slog.Info("shutdown complete")
+}
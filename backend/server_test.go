@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"pillar-bank/auth"
+	"pillar-bank/codec"
+	"pillar-bank/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// starts serve on a free port with a handler that takes delay to respond;
+// started is closed once the handler is running
+func startSlowServer(t *testing.T, ctx context.Context, delay, drain time.Duration) (string, chan struct{}, chan error) {
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(delay)
+		io.WriteString(w, "done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, newServer(mux), ln, drain) }()
+
+	return "http://" + ln.Addr().String(), started, done
+}
+
+func TestServeDrainsOnSignal(t *testing.T) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	url, started, done := startSlowServer(t, ctx, 300*time.Millisecond, 5*time.Second)
+
+	type result struct {
+		body string
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resCh <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	// the in-flight request completes despite the signal
+	res := <-resCh
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after draining")
+	}
+
+	// no new connections are accepted
+	_, err := http.Get(url + "/slow")
+	assert.Error(t, err)
+}
+
+func TestServeDrainDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	url, started, done := startSlowServer(t, ctx, time.Second, 50*time.Millisecond)
+
+	go http.Get(url + "/slow")
+	<-started
+	cancel()
+
+	// a request outliving the drain deadline is reported, not waited on forever
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("serve did not give up at the drain deadline")
+	}
+}
+
+// tests that shutdown lets a background worker finish before closing the
+// database it uses
+func TestShutdownWaitsForWorkers(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://localhost/unused?sslmode=disable")
+	require.NoError(t, err)
+
+	var workers sync.WaitGroup
+	var finished atomic.Bool
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+	}()
+
+	shutdown(db, &workers, func(context.Context) error { return nil })
+	assert.True(t, finished.Load())
+}
+
+// tests that oversized bodies are refused whether or not they declare their length
+func TestLimitBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{codecs: codec.Default()}
+	router := gin.New()
+	router.Use(limitBody(64))
+	router.POST("/wire-messages", asPrincipal(auth.RoleOperator), h.postWireMessage)
+
+	body := "seq=1;sender_rtn=021000021;sender_an=" + strings.Repeat("1", 64) + ";receiver_rtn=121145307;receiver_an=1;amount=1"
+
+	t.Run("Declared length", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		p := assertProblem(t, w, problem.CodePayloadTooLarge)
+		assert.Equal(t, "Request body must be at most 64 bytes", p.Detail)
+	})
+
+	t.Run("Chunked", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader(body))
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assertProblem(t, w, problem.CodePayloadTooLarge)
+	})
+
+	t.Run("Within the limit", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/wire-messages", strings.NewReader("seq=1"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assertProblem(t, w, problem.CodeValidationFailed)
+	})
+}
@@ -71,54 +71,124 @@ var ValidMessages = []struct {
 	},
 }
 
+// Violation is one entry expected in a rejection's errors list
+type Violation struct {
+	Code    string
+	Pointer string
+}
+
 var InvalidMessages = []struct {
-	Name          string
-	WireMessage   string
-	ExpectedError string
+	Name           string
+	WireMessage    string
+	ExpectedCode   string
+	ExpectedErrors []Violation
 }{
 	{
-		Name:          "Empty message",
-		WireMessage:   "",
-		ExpectedError: `{"error": "invalid message format: must contain all information"}`,
+		Name:           "Empty message",
+		WireMessage:    "",
+		ExpectedCode:   "INVALID_FORMAT",
+		ExpectedErrors: []Violation{{"INVALID_FORMAT", ""}},
+	},
+	{
+		Name:           "Invalid SEQ",
+		WireMessage:    "seq=hello world;sender_rtn=1234;sender_an=12345678;receiver_rtn=987654321;receiver_an=87654321;amount=1000",
+		ExpectedCode:   "VALIDATION_FAILED",
+		ExpectedErrors: []Violation{{"INVALID_SEQ", "/seq"}, {"INVALID_RTN", "/sender_rtn"}},
+	},
+	{
+		Name:           "Duplicate SEQ",
+		WireMessage:    "seq=1;sender_rtn=021000021;sender_an=537646894897833;receiver_rtn=121145307;receiver_an=669907820975207;amount=3424",
+		ExpectedCode:   "DUPLICATE_SEQ",
+		ExpectedErrors: []Violation{{"DUPLICATE_SEQ", "/seq"}},
+	},
+	{
+		Name:           "Invalid Sender RTN length",
+		WireMessage:    "seq=6;sender_rtn=0021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000",
+		ExpectedCode:   "INVALID_RTN",
+		ExpectedErrors: []Violation{{"INVALID_RTN", "/sender_rtn"}},
+	},
+	{
+		Name:           "Invalid Sender RTN",
+		WireMessage:    "seq=7;sender_rtn=hello world;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000",
+		ExpectedCode:   "INVALID_RTN",
+		ExpectedErrors: []Violation{{"INVALID_RTN", "/sender_rtn"}},
+	},
+	{
+		Name:           "Invalid Receiver RTN length",
+		WireMessage:    "seq=8;sender_rtn=021000021;sender_an=12345678;receiver_rtn=21145307;receiver_an=87654321;amount=1000",
+		ExpectedCode:   "INVALID_RTN",
+		ExpectedErrors: []Violation{{"INVALID_RTN", "/receiver_rtn"}},
+	},
+	{
+		Name:           "Invalid Receiver RTN",
+		WireMessage:    "seq=9;sender_rtn=021000021;sender_an=12345678;receiver_rtn=hello world;receiver_an=87654321;amount=1000",
+		ExpectedCode:   "INVALID_RTN",
+		ExpectedErrors: []Violation{{"INVALID_RTN", "/receiver_rtn"}},
+	},
+	{
+		Name:           "Invalid Amount",
+		WireMessage:    "seq=10;sender_rtn=021000021;sender_an=12345678;receiver_rtn=hello world;receiver_an=87654321;amount=-5",
+		ExpectedCode:   "VALIDATION_FAILED",
+		ExpectedErrors: []Violation{{"INVALID_RTN", "/receiver_rtn"}, {"INVALID_AMOUNT", "/amount"}},
+	},
+	{
+		Name:           "Invalid Amount type",
+		WireMessage:    "seq=11;sender_rtn=021000021;sender_an=629385443170308;receiver_rtn=121145307;receiver_an=136657407199052;amount=hello world",
+		ExpectedCode:   "INVALID_AMOUNT",
+		ExpectedErrors: []Violation{{"INVALID_AMOUNT", "/amount"}},
+	},
+	{
+		Name:           "Missing field",
+		WireMessage:    "seq=12;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321",
+		ExpectedCode:   "MISSING_FIELD",
+		ExpectedErrors: []Violation{{"MISSING_FIELD", "/amount"}},
 	},
 	{
-		Name:          "Invalid SEQ",
-		WireMessage:   "seq=hello world;sender_rtn=1234;sender_an=12345678;receiver_rtn=987654321;receiver_an=87654321;amount=1000",
-		ExpectedError: `{"error": "invalid SEQ format: must be numeric"}`,
+		Name:           "Unknown field",
+		WireMessage:    "seq=13;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_ab=87654321;amount=1000",
+		ExpectedCode:   "VALIDATION_FAILED",
+		ExpectedErrors: []Violation{{"UNKNOWN_FIELD", "/receiver_ab"}, {"MISSING_FIELD", "/receiver_an"}},
 	},
 	{
-		Name:          "Duplicate SEQ",
-		WireMessage:   "seq=1;sender_rtn=021000021;sender_an=537646894897833;receiver_rtn=121145307;receiver_an=669907820975207;amount=3424",
-		ExpectedError: `{"error": "duplicate sequence number 1"}`,
+		Name:           "Duplicate field",
+		WireMessage:    "seq=14;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000;amount=2000",
+		ExpectedCode:   "DUPLICATE_FIELD",
+		ExpectedErrors: []Violation{{"DUPLICATE_FIELD", "/amount"}},
 	},
 	{
-		Name:          "Invalid Sender RTN length",
-		WireMessage:   "seq=6;sender_rtn=0021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000",
-		ExpectedError: `{"error": "invalid RTN format: must be exactly 9 digits"}`,
+		Name:           "Empty value",
+		WireMessage:    "seq=15;sender_rtn=021000021;sender_an=;receiver_rtn=121145307;receiver_an=87654321;amount=1000",
+		ExpectedCode:   "EMPTY_VALUE",
+		ExpectedErrors: []Violation{{"EMPTY_VALUE", "/sender_an"}},
 	},
 	{
-		Name:          "Invalid Sender RTN",
-		WireMessage:   "seq=7;sender_rtn=hello world;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000",
-		ExpectedError: `{"error": "invalid RTN format: must be exactly 9 digits"}`,
+		Name:           "Fields out of order",
+		WireMessage:    "seq=16;sender_rtn=021000021;receiver_rtn=121145307;sender_an=12345678;receiver_an=87654321;amount=1000",
+		ExpectedCode:   "OUT_OF_ORDER",
+		ExpectedErrors: []Violation{{"OUT_OF_ORDER", "/sender_an"}},
 	},
 	{
-		Name:          "Invalid Receiver RTN length",
-		WireMessage:   "seq=8;sender_rtn=021000021;sender_an=12345678;receiver_rtn=21145307;receiver_an=87654321;amount=1000",
-		ExpectedError: `{"error": "invalid RTN format: must be exactly 9 digits"}`,
+		Name:           "Unescaped separator in value",
+		WireMessage:    "seq=17;sender_rtn=021000021;sender_an=1234=5678;receiver_rtn=121145307;receiver_an=87654321;amount=1000",
+		ExpectedCode:   "VALIDATION_FAILED",
+		ExpectedErrors: []Violation{{"INVALID_FORMAT", ""}, {"MISSING_FIELD", "/sender_an"}},
 	},
 	{
-		Name:          "Invalid Receiver RTN",
-		WireMessage:   "seq=9;sender_rtn=021000021;sender_an=12345678;receiver_rtn=hello world;receiver_an=87654321;amount=1000",
-		ExpectedError: `{"error": "invalid RTN format: must be exactly 9 digits"}`,
+		Name:           "Beneficiary name too long",
+		WireMessage:    "seq=18;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000;beneficiary_name=Bartholomew Montgomery-Fitzgerald III",
+		ExpectedCode:   "VALUE_TOO_LONG",
+		ExpectedErrors: []Violation{{"VALUE_TOO_LONG", "/beneficiary_name"}},
 	},
 	{
-		Name:          "Invalid Amount",
-		WireMessage:   "seq=10;sender_rtn=021000021;sender_an=12345678;receiver_rtn=hello world;receiver_an=87654321;amount=-5",
-		ExpectedError: `{"error": "invalid RTN format: must be exactly 9 digits"}`,
+		Name:           "Invalid Fedwire fields",
+		WireMessage:    "seq=19;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=1000;type_subtype=10;business_function_code=ctr;originator_name=Zoë Müller",
+		ExpectedCode:   "VALIDATION_FAILED",
+		ExpectedErrors: []Violation{{"INVALID_TYPE_SUBTYPE", "/type_subtype"}, {"INVALID_BUSINESS_FUNCTION", "/business_function_code"}, {"INVALID_CHARACTERS", "/originator_name"}},
 	},
 	{
-		Name:          "Invalid Amount type",
-		WireMessage:   "seq=11;sender_rtn=021000021;sender_an=629385443170308;receiver_rtn=121145307;receiver_an=136657407199052;amount=hello world",
-		ExpectedError: `{"error": "invalid amount format: must be numeric"}`,
+		Name:           "Every error at once",
+		WireMessage:    "seq=x;sender_rtn=1;sender_rtn=2;receiver_rtn=;foo=bar;amount=y",
+		ExpectedCode:   "VALIDATION_FAILED",
+		ExpectedErrors: []Violation{{"INVALID_SEQ", "/seq"}, {"INVALID_RTN", "/sender_rtn"}, {"DUPLICATE_FIELD", "/sender_rtn"}, {"EMPTY_VALUE", "/receiver_rtn"}, {"UNKNOWN_FIELD", "/foo"}, {"INVALID_AMOUNT", "/amount"}, {"MISSING_FIELD", "/sender_an"}, {"MISSING_FIELD", "/receiver_an"}},
 	},
 }
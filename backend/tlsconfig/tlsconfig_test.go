@@ -0,0 +1,223 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keyPair is a certificate with its key, signed by parent or self-signed
+type keyPair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newKeyPair(t *testing.T, cn string, isCA bool, parent *keyPair) *keyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Pillar Bank Test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{cn},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &keyPair{cert: cert, key: key, der: der}
+}
+
+// writes the pair as PEM files and returns their paths
+func (kp *keyPair) write(t *testing.T, dir string) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(kp.key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: kp.der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func (kp *keyPair) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{kp.der}, PrivateKey: kp.key, Leaf: kp.cert}
+}
+
+// returns the serial of the certificate the reloader currently serves
+func servedSerial(t *testing.T, r *Reloader) *big.Int {
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.SerialNumber
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := newKeyPair(t, "localhost", false, nil)
+	certFile, keyFile := first.write(t, dir)
+
+	r, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, first.cert.SerialNumber, servedSerial(t, r))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	t.Run("picks up a renewed certificate", func(t *testing.T) {
+		second := newKeyPair(t, "localhost", false, nil)
+		second.write(t, dir)
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(certFile, future, future))
+
+		assert.Eventually(t, func() bool {
+			return servedSerial(t, r).Cmp(second.cert.SerialNumber) == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("keeps the current certificate when the new one is broken", func(t *testing.T) {
+		current := servedSerial(t, r)
+		require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+
+		assert.Error(t, r.Reload())
+		assert.Equal(t, current, servedSerial(t, r))
+	})
+}
+
+func TestNewReloaderMissingFiles(t *testing.T) {
+	_, err := NewReloader(filepath.Join(t.TempDir(), "cert.pem"), filepath.Join(t.TempDir(), "key.pem"))
+	assert.Error(t, err)
+}
+
+func TestServerMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newKeyPair(t, "Partner CA", true, nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der}), 0o600))
+
+	server := newKeyPair(t, "pillar-bank.test", false, ca)
+	certFile, keyFile := server.write(t, dir)
+	reloader, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	partner := newKeyPair(t, "partner-a", false, ca)
+	stranger := newKeyPair(t, "partner-a", false, nil)
+
+	// starts a server that echoes the verified client common name
+	start := func(t *testing.T, clientAuth string) *httptest.Server {
+		cfg, err := Server(reloader, caFile, clientAuth)
+		require.NoError(t, err)
+
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.VerifiedChains) == 0 {
+				io.WriteString(w, "anonymous")
+				return
+			}
+			io.WriteString(w, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+		}))
+		ts.TLS = cfg
+		ts.Config.ErrorLog = log.New(io.Discard, "", 0) // refused handshakes are expected
+		ts.StartTLS()
+		t.Cleanup(ts.Close)
+		return ts
+	}
+
+	// fetches / presenting the client certificate, if any, even when the
+	// server would not accept its issuer
+	get := func(ts *httptest.Server, certs ...tls.Certificate) (string, error) {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		tlsCfg := &tls.Config{RootCAs: roots, ServerName: "pillar-bank.test"}
+		if len(certs) > 0 {
+			tlsCfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &certs[0], nil
+			}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	t.Run("optional", func(t *testing.T) {
+		ts := start(t, ClientAuthOptional)
+
+		body, err := get(ts, partner.tlsCertificate())
+		require.NoError(t, err)
+		assert.Equal(t, "partner-a", body)
+
+		body, err = get(ts)
+		require.NoError(t, err)
+		assert.Equal(t, "anonymous", body)
+
+		_, err = get(ts, stranger.tlsCertificate())
+		assert.Error(t, err, "certificates from another CA are refused")
+	})
+
+	t.Run("require", func(t *testing.T) {
+		ts := start(t, ClientAuthRequire)
+
+		body, err := get(ts, partner.tlsCertificate())
+		require.NoError(t, err)
+		assert.Equal(t, "partner-a", body)
+
+		_, err = get(ts)
+		assert.Error(t, err)
+	})
+}
+
+func TestServerInvalidClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newKeyPair(t, "localhost", false, nil).write(t, dir)
+	reloader, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("no certificates here"), 0o600))
+
+	_, err = Server(reloader, caFile, ClientAuthOptional)
+	assert.ErrorContains(t, err, "no certificates")
+
+	cfg, err := Server(reloader, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+}
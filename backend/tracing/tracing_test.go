@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// installs an in-memory tracer provider for the duration of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// returns the attribute value with the given key
+func attr(attrs []attribute.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestMiddlewarePropagatesTraceContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/wire-message/:seq", func(c *gin.Context) {
+		_, span := StartSQL(c.Request.Context(), "SELECT", "SELECT * FROM wire_messages WHERE seq = $1")
+		End(span, nil)
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/wire-message/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	sqlSpan, serverSpan := spans[0], spans[1]
+
+	assert.Equal(t, "GET /wire-message/:seq", serverSpan.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent().SpanID().String())
+	assert.Equal(t, "/wire-message/:seq", attr(serverSpan.Attributes(), "http.route"))
+	assert.Equal(t, "200", attr(serverSpan.Attributes(), "http.response.status_code"))
+
+	assert.Equal(t, "sql SELECT", sqlSpan.Name())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), sqlSpan.Parent().SpanID())
+	assert.Equal(t, "postgresql", attr(sqlSpan.Attributes(), "db.system"))
+	assert.Equal(t, "SELECT * FROM wire_messages WHERE seq = $1", attr(sqlSpan.Attributes(), "db.statement"))
+}
+
+func TestMiddlewareMarksServerErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/fail", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/fail", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestEndRecordsError(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, span := Start(context.Background(), "parseWireMessage")
+	End(span, assert.AnError)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, assert.AnError.Error(), spans[0].Status().Description)
+}
+
+func TestSetup(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	for _, exporter := range []string{"", ExporterNone, ExporterStdout} {
+		shutdown, err := Setup(context.Background(), "pillar-bank-test", exporter)
+		require.NoError(t, err, exporter)
+		assert.NoError(t, shutdown(context.Background()))
+	}
+
+	_, err := Setup(context.Background(), "pillar-bank-test", "zipkin")
+	assert.EqualError(t, err, `invalid trace exporter "zipkin": must be none, stdout or otlp`)
+}
@@ -0,0 +1,167 @@
+package wire
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The wire string format is a list of key=value fields separated by ";":
+//
+//	message = field *( ";" field )
+//	field   = OWS key OWS "=" OWS value OWS
+//	key     = 1*( %x61-7A / DIGIT / "_" )        ; lowercase letters, digits, _
+//	value   = *( vchar / escape )
+//	vchar   = any character except ";", "=", "\" and control characters
+//	escape  = "\" ( ";" / "=" / "\" )
+//	OWS     = *( SP / HTAB / CR / LF )
+//
+// Whitespace around keys and values is not significant. A literal ";", "="
+// or "\" inside a value must be escaped with a backslash.
+
+// characters that must be escaped inside a value
+const escapable = `;=\`
+
+// Field is one key=value pair of a message, with escapes resolved
+type Field struct {
+	Key   string
+	Value string
+	Part  int // 1-based position in the message
+}
+
+// Tokenize splits message into fields according to the grammar. Every part
+// that breaks the grammar is reported in the returned Errors; the fields
+// that could be read are returned either way so they can still be checked.
+func Tokenize(message string) ([]Field, error) {
+	var fields []Field
+	var errs Errors
+
+	start := 0
+	for part := 1; ; part++ {
+		field, end, err := readField(message, start, part)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			fields = append(fields, field)
+		}
+
+		if end >= len(message) {
+			break
+		}
+		start = end + 1
+	}
+
+	if len(errs) > 0 {
+		return fields, errs
+	}
+	return fields, nil
+}
+
+// reads the field starting at start, returning it and the index of the
+// unescaped ";" ending it, or len(s) for the last field. Errors never quote
+// the part, it may hold an account number.
+func readField(s string, start, part int) (Field, int, *Error) {
+	var key, value strings.Builder
+	var problem string
+	inValue := false
+
+	fail := func(msg string) {
+		if problem == "" {
+			problem = msg
+		}
+	}
+
+	i := start
+	for ; i < len(s) && s[i] != ';'; i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\':
+			if i+1 >= len(s) {
+				fail("ends with an incomplete escape")
+				continue
+			}
+			i++
+			if !strings.ContainsRune(escapable, rune(s[i])) {
+				fail(`has an invalid escape, only \; \= and \\ are allowed`)
+				continue
+			}
+			if !inValue {
+				fail("has an escape in its key")
+				continue
+			}
+			value.WriteByte(s[i])
+		case ch == '=':
+			if inValue {
+				fail(`has an unescaped "=" in its value`)
+				continue
+			}
+			inValue = true
+		case inValue:
+			value.WriteByte(ch)
+		default:
+			key.WriteByte(ch)
+		}
+	}
+
+	field := Field{
+		Key:   strings.Trim(key.String(), ows),
+		Value: strings.Trim(value.String(), ows),
+		Part:  part,
+	}
+
+	switch {
+	case problem != "":
+	case !inValue:
+		fail("is not key=value")
+	case !validKey(field.Key):
+		fail("has an invalid key, keys are lowercase letters, digits and _")
+	case hasControl(field.Value):
+		fail("has a control character in its value")
+	}
+
+	if problem != "" {
+		return Field{}, i, &Error{Reason: ReasonInvalidFormat, Message: fmt.Sprintf("invalid message format: part %d %s", part, problem)}
+	}
+	return field, i, nil
+}
+
+// optional whitespace around keys and values
+const ows = " \t\r\n"
+
+// checks key against the key rule of the grammar
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// checks if s holds a control character other than a tab
+func hasControl(s string) bool {
+	for _, r := range s {
+		if r < 0x20 && r != '\t' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// Escape quotes the characters of value that the grammar reserves
+func Escape(value string) string {
+	if !strings.ContainsAny(value, escapable) {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if strings.IndexByte(escapable, value[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,355 @@
+package wire
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pillar-bank/models"
+)
+
+// reasons a message is rejected, used as metric label values and, upper
+// cased, as error codes
+const (
+	ReasonInvalidFormat  = "invalid_format"
+	ReasonInvalidSeq     = "invalid_seq"
+	ReasonInvalidRTN     = "invalid_rtn"
+	ReasonInvalidAccount = "invalid_account"
+	ReasonInvalidAmount  = "invalid_amount"
+	ReasonMissingField   = "missing_field"
+	ReasonDuplicateField = "duplicate_field"
+	ReasonUnknownField   = "unknown_field"
+	ReasonEmptyValue     = "empty_value"
+	ReasonOutOfOrder     = "out_of_order"
+
+	ReasonInvalidTypeSubtype      = "invalid_type_subtype"
+	ReasonInvalidBusinessFunction = "invalid_business_function"
+	ReasonInvalidCharacters       = "invalid_characters"
+	ReasonValueTooLong            = "value_too_long"
+)
+
+// fields every message must contain, in the order they must appear
+var fields = []string{"seq", "sender_rtn", "sender_an", "receiver_rtn", "receiver_an", "amount"}
+
+// optional Fedwire fields, which may follow the required ones in this order:
+// type/subtype {1510}, business function code {3600}, beneficiary {4200},
+// reference for beneficiary {4320}, originator {5000} and originator to
+// beneficiary information {6000}
+var extendedFields = []string{
+	"type_subtype", "business_function_code",
+	"beneficiary_name", "beneficiary_address", "beneficiary_reference",
+	"originator_name", "originator_address", "remittance_info",
+}
+
+// Fedwire limits on the free text fields, in characters. Addresses are
+// three lines of 35 and remittance information four.
+var textLimits = map[string]int{
+	"beneficiary_name":      35,
+	"beneficiary_address":   105,
+	"beneficiary_reference": 16,
+	"originator_name":       35,
+	"originator_address":    105,
+	"remittance_info":       140,
+}
+
+// Error describes one violation found in a message. Field is empty when the
+// violation is not tied to a field.
+type Error struct {
+	Field   string
+	Reason  string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errors lists every violation in a message, in the order they were found
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap lets errors.As find the individual violations
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Parse validates message and returns the wire it describes, with RawMessage
+// set to message and CanonicalMessage to its canonical form. On failure the
+// error is an Errors listing every violation rather than just the first.
+func Parse(message string) (models.WireMessage, error) {
+	wm := models.WireMessage{}
+	if strings.Trim(message, ows) == "" {
+		return wm, Errors{{Reason: ReasonInvalidFormat, Message: "invalid message format: message is empty"}}
+	}
+
+	tokens, err := Tokenize(message)
+	var errs Errors
+	if err != nil {
+		errs = err.(Errors)
+	}
+
+	seen := make(map[string]bool, len(fields))
+	last := -1
+	for _, token := range tokens {
+		index := fieldIndex(token.Key)
+		if index < 0 {
+			errs = append(errs, &Error{token.Key, ReasonUnknownField, fmt.Sprintf("unknown field: %q is not a wire message field", token.Key)})
+			continue
+		}
+		if seen[token.Key] {
+			errs = append(errs, &Error{token.Key, ReasonDuplicateField, fmt.Sprintf("duplicate field: %s appears more than once", token.Key)})
+			continue
+		}
+		seen[token.Key] = true
+
+		if index < last {
+			errs = append(errs, &Error{token.Key, ReasonOutOfOrder, fmt.Sprintf("out of order: %s must come before %s", token.Key, fieldAt(last))})
+		} else {
+			last = index
+		}
+
+		if token.Value == "" {
+			errs = append(errs, &Error{token.Key, ReasonEmptyValue, fmt.Sprintf("empty value: %s must not be empty", token.Key)})
+			continue
+		}
+		if err := setField(&wm, token.Key, token.Value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, field := range fields {
+		if !seen[field] {
+			errs = append(errs, &Error{field, ReasonMissingField, fmt.Sprintf("missing field: %s is required", field)})
+		}
+	}
+
+	if len(errs) > 0 {
+		return models.WireMessage{}, errs
+	}
+
+	wm.RawMessage = message
+	wm.CanonicalMessage = Format(wm)
+	return wm, nil
+}
+
+// returns the position of key in the field order, or -1 if it is unknown
+func fieldIndex(key string) int {
+	for i, field := range fields {
+		if key == field {
+			return i
+		}
+	}
+	for i, field := range extendedFields {
+		if key == field {
+			return len(fields) + i
+		}
+	}
+	return -1
+}
+
+// returns the field at index in the field order
+func fieldAt(index int) string {
+	if index < len(fields) {
+		return fields[index]
+	}
+	return extendedFields[index-len(fields)]
+}
+
+// largest seq or amount accepted, as both are stored in INTEGER columns
+const maxInt = math.MaxInt32
+
+// checks if a string is a non-empty run of ASCII digits. Other Unicode
+// digits, such as Arabic-Indic numerals, are rejected.
+func isInt(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checks if s is made of exactly n ASCII upper case letters
+func isCode(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// checks if s only uses the Fedwire character set: printable ASCII, except
+// the "*" that Fedwire uses to delimit elements
+func isFedwireText(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' || s[i] == '*' {
+			return false
+		}
+	}
+	return true
+}
+
+// validates a free text field against the Fedwire character set and its
+// length limit
+func checkText(key, value string) *Error {
+	if !isFedwireText(value) {
+		return &Error{key, ReasonInvalidCharacters, fmt.Sprintf("invalid characters: %s must be printable ASCII without \"*\"", key)}
+	}
+	if limit := textLimits[key]; len(value) > limit {
+		return &Error{key, ReasonValueTooLong, fmt.Sprintf("value too long: %s must be at most %d characters", key, limit)}
+	}
+	return nil
+}
+
+// parses the digits in s, reporting false when the number is above maxInt
+func parseInt(s string) (int, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n > maxInt {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// validates value and stores it in the field named by key
+func setField(wm *models.WireMessage, key, value string) *Error {
+	switch key {
+	case "seq":
+		if !isInt(value) {
+			return &Error{"seq", ReasonInvalidSeq, "invalid SEQ format: must be numeric"}
+		}
+		seqNum, ok := parseInt(value)
+		if !ok {
+			return &Error{"seq", ReasonInvalidSeq, fmt.Sprintf("invalid SEQ: must be at most %d", maxInt)}
+		}
+		wm.Seq = seqNum
+	case "sender_rtn":
+		if !isInt(value) || len(value) != 9 {
+			return &Error{"sender_rtn", ReasonInvalidRTN, "invalid RTN format: must be exactly 9 digits"}
+		}
+		wm.SenderRTN = value
+	case "sender_an":
+		if !isInt(value) {
+			return &Error{"sender_an", ReasonInvalidAccount, "invalid AN format: must be numeric"}
+		}
+		wm.SenderAN = value
+	case "receiver_rtn":
+		if !isInt(value) || len(value) != 9 {
+			return &Error{"receiver_rtn", ReasonInvalidRTN, "invalid RTN format: must be exactly 9 digits"}
+		}
+		wm.ReceiverRTN = value
+	case "receiver_an":
+		if !isInt(value) {
+			return &Error{"receiver_an", ReasonInvalidAccount, "invalid AN format: must be numeric"}
+		}
+		wm.ReceiverAN = value
+	case "amount":
+		if !isInt(value) {
+			return &Error{"amount", ReasonInvalidAmount, "invalid amount format: must be numeric"}
+		}
+		// a sign never gets past isInt, so amounts cannot be negative
+		amount, ok := parseInt(value)
+		if !ok {
+			return &Error{"amount", ReasonInvalidAmount, fmt.Sprintf("invalid amount: must be at most %d", maxInt)}
+		}
+		wm.Amount = amount
+	case "type_subtype":
+		if !isInt(value) || len(value) != 4 {
+			return &Error{"type_subtype", ReasonInvalidTypeSubtype, "invalid type/subtype: must be exactly 4 digits"}
+		}
+		wm.TypeSubtype = value
+	case "business_function_code":
+		if !isCode(value, 3) {
+			return &Error{"business_function_code", ReasonInvalidBusinessFunction, "invalid business function code: must be exactly 3 upper case letters"}
+		}
+		wm.BusinessFunctionCode = value
+	default:
+		if err := checkText(key, value); err != nil {
+			return err
+		}
+		*textField(wm, key) = value
+	}
+	return nil
+}
+
+// returns the field of wm holding the free text field key
+func textField(wm *models.WireMessage, key string) *string {
+	switch key {
+	case "beneficiary_name":
+		return &wm.BeneficiaryName
+	case "beneficiary_address":
+		return &wm.BeneficiaryAddress
+	case "beneficiary_reference":
+		return &wm.BeneficiaryReference
+	case "originator_name":
+		return &wm.OriginatorName
+	case "originator_address":
+		return &wm.OriginatorAddress
+	}
+	return &wm.RemittanceInfo
+}
+
+// Format writes wm in canonical form: every field in order, no whitespace,
+// numbers without leading zeros and reserved characters escaped. Optional
+// fields are left out when empty. It is the inverse of Parse for any wire
+// Parse accepts.
+func Format(wm models.WireMessage) string {
+	values := []string{
+		strconv.Itoa(wm.Seq),
+		wm.SenderRTN,
+		wm.SenderAN,
+		wm.ReceiverRTN,
+		wm.ReceiverAN,
+		strconv.Itoa(wm.Amount),
+		wm.TypeSubtype,
+		wm.BusinessFunctionCode,
+		wm.BeneficiaryName,
+		wm.BeneficiaryAddress,
+		wm.BeneficiaryReference,
+		wm.OriginatorName,
+		wm.OriginatorAddress,
+		wm.RemittanceInfo,
+	}
+
+	var b strings.Builder
+	for i, value := range values {
+		if i >= len(fields) && value == "" {
+			continue
+		}
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(fieldAt(i))
+		b.WriteByte('=')
+		b.WriteString(Escape(value))
+	}
+	return b.String()
+}
+
+// Canonicalize validates message and returns its canonical form, so two
+// messages describing the same wire canonicalize to the same string
+func Canonicalize(message string) (string, error) {
+	wm, err := Parse(message)
+	if err != nil {
+		return "", err
+	}
+	return wm.CanonicalMessage, nil
+}
@@ -0,0 +1,422 @@
+package wire
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"pillar-bank/models"
+	"pillar-bank/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		expected []Field
+		errors   int
+	}{
+		{"Simple", "a=1;b=2", []Field{{"a", "1", 1}, {"b", "2", 2}}, 0},
+		{"Whitespace is trimmed", " a = 1 ;\tb=2\r\n", []Field{{"a", "1", 1}, {"b", "2", 2}}, 0},
+		{"Inner whitespace is kept", "name=Jane  Doe", []Field{{"name", "Jane  Doe", 1}}, 0},
+		{"Escapes", `memo=a\;b\=c\\d`, []Field{{"memo", `a;b=c\d`, 1}}, 0},
+		{"Empty value", "a=", []Field{{"a", "", 1}}, 0},
+		{"Unescaped equals", "a=1=2;b=2", []Field{{"b", "2", 2}}, 1},
+		{"Missing equals", "a;b=2", []Field{{"b", "2", 2}}, 1},
+		{"Empty key", "=1", nil, 1},
+		{"Uppercase key", "SEQ=1", nil, 1},
+		{"Invalid escape", `a=\n`, nil, 1},
+		{"Dangling escape", `a=1\`, nil, 1},
+		{"Control character", "a=1\x00", nil, 1},
+		{"Trailing separator", "a=1;", []Field{{"a", "1", 1}}, 1},
+		{"Every part broken", "a;b;c", nil, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := Tokenize(tt.message)
+			assert.Equal(t, tt.expected, fields)
+
+			if tt.errors == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var errs Errors
+			require.True(t, errors.As(err, &errs))
+			assert.Len(t, errs, tt.errors)
+			for _, e := range errs {
+				assert.Equal(t, ReasonInvalidFormat, e.Reason)
+			}
+		})
+	}
+}
+
+// tests that syntax errors never echo the message, which may hold an account number
+func TestTokenizeErrorsDoNotEchoInput(t *testing.T) {
+	_, err := Tokenize("sender_an=537646894897833=1")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "537646894897833")
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range testdata.ValidMessages {
+		t.Run(tt.Name, func(t *testing.T) {
+			wm, err := Parse(tt.WireMessage)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Expected.Seq, wm.Seq)
+			assert.Equal(t, tt.Expected.SenderAN, wm.SenderAN)
+			assert.Equal(t, tt.Expected.Amount, wm.Amount)
+			assert.Equal(t, tt.WireMessage, wm.RawMessage)
+			// the test messages are already canonical
+			assert.Equal(t, tt.WireMessage, wm.CanonicalMessage)
+		})
+	}
+}
+
+// tests that numbers are plain ASCII digits that fit the INTEGER columns
+func TestParseNumbers(t *testing.T) {
+	const rest = ";sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount="
+
+	tests := []struct {
+		name   string
+		seq    string
+		amount string
+		reason string // empty when the message is valid
+	}{
+		{"Largest values", "2147483647", "2147483647", ""},
+		{"Zero", "0", "0", ""},
+		{"Arabic-Indic seq", "\u0661\u0662", "100", ReasonInvalidSeq},
+		{"Fullwidth amount", "1", "\uff11\uff10", ReasonInvalidAmount},
+		{"Seq overflows INTEGER", "2147483648", "100", ReasonInvalidSeq},
+		{"Amount overflows INTEGER", "1", "2147483648", ReasonInvalidAmount},
+		{"Amount overflows int64", "1", "99999999999999999999", ReasonInvalidAmount},
+		{"Signed amount", "1", "+100", ReasonInvalidAmount},
+		{"Negative amount", "1", "-100", ReasonInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("seq=" + tt.seq + rest + tt.amount)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var errs Errors
+			require.True(t, errors.As(err, &errs))
+			require.Len(t, errs, 1)
+			assert.Equal(t, tt.reason, errs[0].Reason)
+		})
+	}
+}
+
+func TestParseExtendedFields(t *testing.T) {
+	const required = "seq=1;sender_rtn=021000021;sender_an=12345678;receiver_rtn=121145307;receiver_an=87654321;amount=100"
+
+	t.Run("Every field", func(t *testing.T) {
+		message := required + ";type_subtype=1000;business_function_code=CTR" +
+			";beneficiary_name=Jane Doe;beneficiary_address=1 Main St, Springfield IL 62701;beneficiary_reference=INV-2024-0042" +
+			`;originator_name=Acme Corp.;originator_address=PO Box 12\\;remittance_info=Invoice 42 \; 43 (final)`
+		wm, err := Parse(message)
+		require.NoError(t, err)
+		assert.Equal(t, "1000", wm.TypeSubtype)
+		assert.Equal(t, "CTR", wm.BusinessFunctionCode)
+		assert.Equal(t, "Jane Doe", wm.BeneficiaryName)
+		assert.Equal(t, "1 Main St, Springfield IL 62701", wm.BeneficiaryAddress)
+		assert.Equal(t, "INV-2024-0042", wm.BeneficiaryReference)
+		assert.Equal(t, "Acme Corp.", wm.OriginatorName)
+		assert.Equal(t, `PO Box 12\`, wm.OriginatorAddress)
+		assert.Equal(t, "Invoice 42 ; 43 (final)", wm.RemittanceInfo)
+		assert.Equal(t, message, wm.CanonicalMessage)
+	})
+
+	t.Run("Empty optional fields are left out of the canonical form", func(t *testing.T) {
+		wm, err := Parse(required + ";originator_name=Acme")
+		require.NoError(t, err)
+		assert.Equal(t, required+";originator_name=Acme", wm.CanonicalMessage)
+	})
+
+	tests := []struct {
+		name   string
+		fields string
+		reason string
+	}{
+		{"Short type/subtype", "type_subtype=10", ReasonInvalidTypeSubtype},
+		{"Letters in type/subtype", "type_subtype=10AB", ReasonInvalidTypeSubtype},
+		{"Lower case business function", "business_function_code=ctr", ReasonInvalidBusinessFunction},
+		{"Long business function", "business_function_code=CTRX", ReasonInvalidBusinessFunction},
+		{"Name over 35 characters", "beneficiary_name=" + strings.Repeat("A", 36), ReasonValueTooLong},
+		{"Reference over 16 characters", "beneficiary_reference=" + strings.Repeat("1", 17), ReasonValueTooLong},
+		{"Address over 105 characters", "originator_address=" + strings.Repeat("A", 106), ReasonValueTooLong},
+		{"Remittance over 140 characters", "remittance_info=" + strings.Repeat("A", 141), ReasonValueTooLong},
+		{"Non-ASCII name", "originator_name=Jos\u00e9", ReasonInvalidCharacters},
+		{"Element delimiter", "remittance_info=a*b", ReasonInvalidCharacters},
+		{"Empty name", "beneficiary_name=", ReasonEmptyValue},
+		{"Out of order", "originator_name=Acme;beneficiary_name=Jane", ReasonOutOfOrder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(required + ";" + tt.fields)
+			var errs Errors
+			require.True(t, errors.As(err, &errs))
+			require.Len(t, errs, 1)
+			assert.Equal(t, tt.reason, errs[0].Reason)
+		})
+	}
+
+	t.Run("Limits are exact", func(t *testing.T) {
+		_, err := Parse(required + ";beneficiary_name=" + strings.Repeat("A", 35) + ";remittance_info=" + strings.Repeat("A", 140))
+		assert.NoError(t, err)
+	})
+}
+
+func TestIsInt(t *testing.T) {
+	assert.True(t, isInt("0123456789"))
+	assert.False(t, isInt(""))
+	assert.False(t, isInt("\u0661"))
+	assert.False(t, isInt("1 2"))
+}
+
+func TestCanonicalize(t *testing.T) {
+	canonical := "seq=7;sender_rtn=021000021;sender_an=0012;receiver_rtn=121145307;receiver_an=34;amount=100"
+
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{"Already canonical", canonical},
+		{"Whitespace", " seq = 7 ; sender_rtn=021000021 ;sender_an= 0012;receiver_rtn=121145307;receiver_an=34;amount=100\n"},
+		{"Leading zeros on numbers", "seq=007;sender_rtn=021000021;sender_an=0012;receiver_rtn=121145307;receiver_an=34;amount=0100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize(tt.message)
+			require.NoError(t, err)
+			assert.Equal(t, canonical, got)
+		})
+	}
+
+	_, err := Canonicalize("seq=7")
+	assert.Error(t, err)
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, "plain", Escape("plain"))
+	assert.Equal(t, `a\;b\=c\\d`, Escape(`a;b=c\d`))
+}
+
+// seeds a fuzz target with every message in testdata
+func addMessages(f *testing.F) {
+	for _, tt := range testdata.ValidMessages {
+		f.Add(tt.WireMessage)
+	}
+	for _, tt := range testdata.InvalidMessages {
+		f.Add(tt.WireMessage)
+	}
+}
+
+// FuzzTokenize checks that tokenizing never panics and that every field it
+// returns obeys the grammar
+func FuzzTokenize(f *testing.F) {
+	addMessages(f)
+	f.Fuzz(func(t *testing.T, message string) {
+		tokens, err := Tokenize(message)
+		if err != nil {
+			var errs Errors
+			require.True(t, errors.As(err, &errs))
+			require.NotEmpty(t, errs)
+		}
+		for _, token := range tokens {
+			require.True(t, validKey(token.Key), "invalid key %q", token.Key)
+			require.False(t, hasControl(token.Value), "control character in %q", token.Value)
+		}
+	})
+}
+
+// FuzzParse checks that parsing never panics, that a parsed wire survives
+// formatting and parsing again, and that canonicalizing is idempotent
+func FuzzParse(f *testing.F) {
+	addMessages(f)
+	f.Fuzz(func(t *testing.T, message string) {
+		wm, err := Parse(message)
+		if err != nil {
+			var errs Errors
+			require.True(t, errors.As(err, &errs))
+			require.NotEmpty(t, errs)
+			for _, e := range errs {
+				require.NotEmpty(t, e.Reason)
+			}
+			return
+		}
+
+		require.True(t, wm.Seq >= 0 && wm.Seq <= maxInt)
+		require.True(t, wm.Amount >= 0 && wm.Amount <= maxInt)
+
+		again, err := Parse(wm.CanonicalMessage)
+		require.NoError(t, err)
+		require.Equal(t, wm.CanonicalMessage, again.CanonicalMessage)
+		wm.RawMessage, again.RawMessage = "", ""
+		require.Equal(t, wm, again)
+	})
+}
+
+// validWire is a wire that satisfies every field rule
+type validWire models.WireMessage
+
+// Generate implements quick.Generator
+func (validWire) Generate(r *rand.Rand, _ int) reflect.Value {
+	// each optional field is set half the time
+	maybe := func(value string) string {
+		if r.Intn(2) == 0 {
+			return ""
+		}
+		return value
+	}
+
+	return reflect.ValueOf(validWire{
+		Seq:                  r.Intn(math.MaxInt32),
+		SenderRTN:            digits(r, 9),
+		SenderAN:             digits(r, 1+r.Intn(17)),
+		ReceiverRTN:          digits(r, 9),
+		ReceiverAN:           digits(r, 1+r.Intn(17)),
+		Amount:               r.Intn(math.MaxInt32),
+		TypeSubtype:          maybe(digits(r, 4)),
+		BusinessFunctionCode: maybe(letters(r, 3)),
+		BeneficiaryName:      maybe(fedwireText(r, textLimits["beneficiary_name"])),
+		BeneficiaryAddress:   maybe(fedwireText(r, textLimits["beneficiary_address"])),
+		BeneficiaryReference: maybe(fedwireText(r, textLimits["beneficiary_reference"])),
+		OriginatorName:       maybe(fedwireText(r, textLimits["originator_name"])),
+		OriginatorAddress:    maybe(fedwireText(r, textLimits["originator_address"])),
+		RemittanceInfo:       maybe(fedwireText(r, textLimits["remittance_info"])),
+	})
+}
+
+// returns n random ASCII digits
+func digits(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + r.Intn(10))
+	}
+	return string(b)
+}
+
+// returns n random upper case letters
+func letters(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('A' + r.Intn(26))
+	}
+	return string(b)
+}
+
+// returns up to max random characters from the Fedwire character set,
+// including the ones that need escaping
+func fedwireText(r *rand.Rand, max int) string {
+	b := make([]byte, r.Intn(max))
+	for i := range b {
+		b[i] = fedwireChars[r.Intn(len(fedwireChars))]
+	}
+	// the tokenizer trims surrounding spaces, so they cannot round trip
+	return strings.TrimLeft(string(b), " ") + "."
+}
+
+// printable ASCII without "*"
+var fedwireChars = func() string {
+	var b strings.Builder
+	for c := byte(' '); c <= '~'; c++ {
+		if c != '*' {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}()
+
+// noisyWire is a valid wire together with a non-canonical message for it:
+// random whitespace around tokens and leading zeros on numbers
+type noisyWire struct {
+	wm      models.WireMessage
+	message string
+}
+
+// Generate implements quick.Generator
+func (noisyWire) Generate(r *rand.Rand, size int) reflect.Value {
+	wm := models.WireMessage(validWire{}.Generate(r, size).Interface().(validWire))
+
+	space := func() string {
+		return strings.Repeat(string(" \t"[r.Intn(2)]), r.Intn(3))
+	}
+	zeros := func() string {
+		return strings.Repeat("0", r.Intn(3))
+	}
+
+	values := []string{
+		zeros() + strconv.Itoa(wm.Seq), wm.SenderRTN, wm.SenderAN, wm.ReceiverRTN, wm.ReceiverAN, zeros() + strconv.Itoa(wm.Amount),
+		wm.TypeSubtype, wm.BusinessFunctionCode, wm.BeneficiaryName, wm.BeneficiaryAddress, wm.BeneficiaryReference,
+		wm.OriginatorName, wm.OriginatorAddress, wm.RemittanceInfo,
+	}
+	var parts []string
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		parts = append(parts, space()+fieldAt(i)+space()+"="+space()+Escape(value)+space())
+	}
+	return reflect.ValueOf(noisyWire{wm: wm, message: strings.Join(parts, ";")})
+}
+
+// tests that Parse inverts Format for every valid wire
+func TestFormatRoundTrip(t *testing.T) {
+	property := func(v validWire) bool {
+		wm := models.WireMessage(v)
+		parsed, err := Parse(Format(wm))
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		parsed.RawMessage, parsed.CanonicalMessage = "", ""
+		return reflect.DeepEqual(parsed, wm)
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 1000}))
+}
+
+// tests that every spelling of a wire canonicalizes to Format of that wire,
+// and that canonicalizing is idempotent
+func TestCanonicalizeProperties(t *testing.T) {
+	property := func(n noisyWire) bool {
+		canonical, err := Canonicalize(n.message)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		again, err := Canonicalize(canonical)
+		return err == nil && canonical == Format(n.wm) && again == canonical
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 1000}))
+}
+
+// tests that any value survives escaping and tokenizing unchanged
+func TestEscapeRoundTrip(t *testing.T) {
+	property := func(value string) bool {
+		// surrounding whitespace is insignificant and control characters are
+		// not allowed, so neither can round trip
+		value = strings.Trim(strings.Map(func(r rune) rune {
+			if r < 0x20 || r == 0x7f {
+				return -1
+			}
+			return r
+		}, value), ows)
+
+		fields, err := Tokenize("memo=" + Escape(value) + ";seq=1")
+		return err == nil && len(fields) == 2 && fields[0].Value == value && fields[1].Value == "1"
+	}
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 1000}))
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"pillar-bank/encryption"
+	"pillar-bank/models"
+)
+
+// columns of wire_messages that are stored encrypted; each name doubles as
+// the authenticated context of its ciphertext
+const (
+	colSenderAN         = "sender_an"
+	colReceiverAN       = "receiver_an"
+	colRawMessage       = "raw_message"
+	colCanonicalMessage = "canonical_message"
+
+	colBeneficiaryName    = "beneficiary_name"
+	colBeneficiaryAddress = "beneficiary_address"
+	colOriginatorName     = "originator_name"
+	colOriginatorAddress  = "originator_address"
+	colRemittanceInfo     = "remittance_info"
+)
+
+// reencryptBatchSize is how many rows the re-encryption job updates per query
+const reencryptBatchSize = 500
+
+// sealedWire holds the at-rest form of a wire's sensitive fields
+type sealedWire struct {
+	senderAN           string
+	senderANIdx        string
+	receiverAN         string
+	receiverANIdx      string
+	rawMessage         string
+	canonicalMessage   string
+	beneficiaryName    string
+	beneficiaryAddress string
+	originatorName     string
+	originatorAddress  string
+	remittanceInfo     string
+}
+
+// optionalColumn is an encrypted column a wire may leave empty
+type optionalColumn struct {
+	name  string
+	value *string
+}
+
+// the encrypted fields of wm that may be empty: the canonical message, which
+// wires accepted before it was introduced lack, and the Fedwire party and
+// remittance fields. Empty values are stored as is, never encrypted.
+func optionalColumns(wm *models.WireMessage) []optionalColumn {
+	return []optionalColumn{
+		{colCanonicalMessage, &wm.CanonicalMessage},
+		{colBeneficiaryName, &wm.BeneficiaryName},
+		{colBeneficiaryAddress, &wm.BeneficiaryAddress},
+		{colOriginatorName, &wm.OriginatorName},
+		{colOriginatorAddress, &wm.OriginatorAddress},
+		{colRemittanceInfo, &wm.RemittanceInfo},
+	}
+}
+
+// encrypts account numbers, the raw and canonical messages and the party and
+// remittance fields, and computes blind indexes
+func sealWireFields(enc *encryption.Envelope, wm models.WireMessage) (sealedWire, error) {
+	var s sealedWire
+	var err error
+
+	if s.senderAN, err = enc.Encrypt(wm.SenderAN, colSenderAN); err != nil {
+		return s, err
+	}
+	if s.receiverAN, err = enc.Encrypt(wm.ReceiverAN, colReceiverAN); err != nil {
+		return s, err
+	}
+	if s.rawMessage, err = enc.Encrypt(wm.RawMessage, colRawMessage); err != nil {
+		return s, err
+	}
+	for _, col := range optionalColumns(&wm) {
+		if *col.value == "" {
+			continue
+		}
+		if *col.value, err = enc.Encrypt(*col.value, col.name); err != nil {
+			return s, err
+		}
+	}
+	s.canonicalMessage = wm.CanonicalMessage
+	s.beneficiaryName = wm.BeneficiaryName
+	s.beneficiaryAddress = wm.BeneficiaryAddress
+	s.originatorName = wm.OriginatorName
+	s.originatorAddress = wm.OriginatorAddress
+	s.remittanceInfo = wm.RemittanceInfo
+	s.senderANIdx = enc.BlindIndex(wm.SenderAN)
+	s.receiverANIdx = enc.BlindIndex(wm.ReceiverAN)
+
+	return s, nil
+}
+
+// decrypts the sensitive fields of a wire scanned from the database
+func (h *Handler) openWireMessage(wm *models.WireMessage) error {
+	var err error
+	if wm.SenderAN, err = h.enc.Decrypt(wm.SenderAN, colSenderAN); err != nil {
+		return err
+	}
+	if wm.ReceiverAN, err = h.enc.Decrypt(wm.ReceiverAN, colReceiverAN); err != nil {
+		return err
+	}
+	if wm.RawMessage, err = h.enc.Decrypt(wm.RawMessage, colRawMessage); err != nil {
+		return err
+	}
+	for _, col := range optionalColumns(wm) {
+		if *col.value, err = openLegacy(h.enc, *col.value, col.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scans a row selected with wireMessageColumns and decrypts it
+func (h *Handler) scanWireMessage(row rowScanner, wm *models.WireMessage) error {
+	var hits, ruleHits string
+	var duplicateOf sql.NullInt64
+	err := row.Scan(&wm.ID, &wm.Seq, &wm.Namespace, &wm.SenderRTN, &wm.SenderAN, &wm.ReceiverRTN, &wm.ReceiverAN, &wm.Amount,
+		&wm.TypeSubtype, &wm.BusinessFunctionCode, &wm.BeneficiaryName, &wm.BeneficiaryAddress, &wm.BeneficiaryReference,
+		&wm.OriginatorName, &wm.OriginatorAddress, &wm.RemittanceInfo, &wm.Status, &hits, &wm.RiskScore, &ruleHits, &duplicateOf,
+		&wm.RawMessage, &wm.CanonicalMessage, &wm.CreatedBy, &wm.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if hits != "" {
+		if err := json.Unmarshal([]byte(hits), &wm.ScreeningHits); err != nil {
+			return fmt.Errorf("wire %d: invalid screening hits: %w", wm.ID, err)
+		}
+	}
+	if ruleHits != "" {
+		if err := json.Unmarshal([]byte(ruleHits), &wm.RuleHits); err != nil {
+			return fmt.Errorf("wire %d: invalid rule hits: %w", wm.ID, err)
+		}
+	}
+	if duplicateOf.Valid {
+		seq := int(duplicateOf.Int64)
+		wm.DuplicateOf = &seq
+	}
+	return h.openWireMessage(wm)
+}
+
+// returns the plaintext of a stored value, which may predate encryption
+func openLegacy(enc *encryption.Envelope, value, context string) (string, error) {
+	if !encryption.IsEncrypted(value) {
+		return value, nil
+	}
+	return enc.Decrypt(value, context)
+}
+
+// reencryptWireMessages brings every row up to the primary master key. Rows
+// written before encryption was introduced are encrypted in place, and rows
+// wrapped by a retired key are re-wrapped, with blind indexes recomputed.
+// It returns the number of rows rewritten.
+func reencryptWireMessages(db *sql.DB, enc *encryption.Envelope) (int, error) {
+	updated := 0
+	lastID := 0
+
+	for {
+		rows, err := db.Query(`SELECT id, sender_an, receiver_an, raw_message, canonical_message,
+			beneficiary_name, beneficiary_address, originator_name, originator_address, remittance_info FROM wire_messages
+			WHERE id > $1 ORDER BY id ASC LIMIT $2`, lastID, reencryptBatchSize)
+		if err != nil {
+			return updated, err
+		}
+
+		var batch []models.WireMessage
+		for rows.Next() {
+			var wm models.WireMessage
+			err := rows.Scan(&wm.ID, &wm.SenderAN, &wm.ReceiverAN, &wm.RawMessage, &wm.CanonicalMessage,
+				&wm.BeneficiaryName, &wm.BeneficiaryAddress, &wm.OriginatorName, &wm.OriginatorAddress, &wm.RemittanceInfo)
+			if err != nil {
+				rows.Close()
+				return updated, err
+			}
+			batch = append(batch, wm)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return updated, err
+		}
+		if len(batch) == 0 {
+			return updated, nil
+		}
+
+		for _, wm := range batch {
+			lastID = wm.ID
+			if !needsReencryption(enc, &wm) {
+				continue
+			}
+
+			if err := openLegacyWire(enc, &wm); err != nil {
+				return updated, fmt.Errorf("wire %d: %w", wm.ID, err)
+			}
+			sealed, err := sealWireFields(enc, wm)
+			if err != nil {
+				return updated, fmt.Errorf("wire %d: %w", wm.ID, err)
+			}
+
+			_, err = db.Exec(`UPDATE wire_messages
+				SET sender_an = $1, sender_an_idx = $2, receiver_an = $3, receiver_an_idx = $4, raw_message = $5, canonical_message = $6,
+					beneficiary_name = $7, beneficiary_address = $8, originator_name = $9, originator_address = $10, remittance_info = $11
+				WHERE id = $12`,
+				sealed.senderAN, sealed.senderANIdx, sealed.receiverAN, sealed.receiverANIdx, sealed.rawMessage, sealed.canonicalMessage,
+				sealed.beneficiaryName, sealed.beneficiaryAddress, sealed.originatorName, sealed.originatorAddress, sealed.remittanceInfo, wm.ID)
+			if err != nil {
+				return updated, fmt.Errorf("wire %d: %w", wm.ID, err)
+			}
+			updated++
+		}
+	}
+}
+
+// checks if any encrypted field of a stored wire is plaintext or wrapped by a
+// retired key. An empty optional field is unset, not plaintext.
+func needsReencryption(enc *encryption.Envelope, wm *models.WireMessage) bool {
+	if enc.NeedsRotation(wm.SenderAN) || enc.NeedsRotation(wm.ReceiverAN) || enc.NeedsRotation(wm.RawMessage) {
+		return true
+	}
+	for _, col := range optionalColumns(wm) {
+		if *col.value != "" && enc.NeedsRotation(*col.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// decrypts every encrypted field of a stored wire, passing through any that
+// predate encryption
+func openLegacyWire(enc *encryption.Envelope, wm *models.WireMessage) error {
+	var err error
+	if wm.SenderAN, err = openLegacy(enc, wm.SenderAN, colSenderAN); err != nil {
+		return err
+	}
+	if wm.ReceiverAN, err = openLegacy(enc, wm.ReceiverAN, colReceiverAN); err != nil {
+		return err
+	}
+	if wm.RawMessage, err = openLegacy(enc, wm.RawMessage, colRawMessage); err != nil {
+		return err
+	}
+	for _, col := range optionalColumns(wm) {
+		if *col.value, err = openLegacy(enc, *col.value, col.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
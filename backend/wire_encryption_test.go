@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"pillar-bank/encryption"
+	"pillar-bank/models"
+	"pillar-bank/testdata"
+	"pillar-bank/wire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealWireFields(t *testing.T) {
+	h := &Handler{enc: testEnvelope()}
+
+	for _, tt := range testdata.ValidMessages {
+		t.Run(tt.Name, func(t *testing.T) {
+			parsed, err := wire.Parse(tt.WireMessage)
+			require.NoError(t, err)
+			sealed, err := sealWireFields(h.enc, parsed)
+			require.NoError(t, err)
+
+			// nothing sensitive is left in the stored form
+			for _, stored := range []string{sealed.senderAN, sealed.receiverAN, sealed.rawMessage, sealed.canonicalMessage} {
+				assert.True(t, encryption.IsEncrypted(stored))
+				assert.NotContains(t, stored, tt.Expected.SenderAN)
+				assert.NotContains(t, stored, tt.Expected.ReceiverAN)
+			}
+			assert.Equal(t, h.enc.BlindIndex(tt.Expected.SenderAN), sealed.senderANIdx)
+			assert.Equal(t, h.enc.BlindIndex(tt.Expected.ReceiverAN), sealed.receiverANIdx)
+
+			wm := models.WireMessage{SenderAN: sealed.senderAN, ReceiverAN: sealed.receiverAN, RawMessage: sealed.rawMessage, CanonicalMessage: sealed.canonicalMessage}
+			require.NoError(t, h.openWireMessage(&wm))
+			assert.Equal(t, tt.Expected.SenderAN, wm.SenderAN)
+			assert.Equal(t, tt.Expected.ReceiverAN, wm.ReceiverAN)
+			assert.Equal(t, tt.WireMessage, wm.RawMessage)
+			assert.Equal(t, parsed.CanonicalMessage, wm.CanonicalMessage)
+		})
+	}
+
+	t.Run("Columns cannot be swapped", func(t *testing.T) {
+		sealed, err := sealWireFields(h.enc, models.WireMessage{SenderAN: "537646894897833", ReceiverAN: "669907820975207", RawMessage: "raw"})
+		require.NoError(t, err)
+
+		wm := models.WireMessage{SenderAN: sealed.receiverAN, ReceiverAN: sealed.senderAN, RawMessage: sealed.rawMessage}
+		assert.Error(t, h.openWireMessage(&wm))
+	})
+
+	t.Run("Legacy wire without canonical message", func(t *testing.T) {
+		sealed, err := sealWireFields(h.enc, models.WireMessage{SenderAN: "537646894897833", ReceiverAN: "669907820975207", RawMessage: "raw"})
+		require.NoError(t, err)
+		assert.Empty(t, sealed.canonicalMessage)
+
+		wm := models.WireMessage{SenderAN: sealed.senderAN, ReceiverAN: sealed.receiverAN, RawMessage: sealed.rawMessage}
+		require.NoError(t, h.openWireMessage(&wm))
+		assert.Empty(t, wm.CanonicalMessage)
+	})
+
+	t.Run("Party and remittance fields", func(t *testing.T) {
+		wm := models.WireMessage{
+			SenderAN: "537646894897833", ReceiverAN: "669907820975207", RawMessage: "raw",
+			BeneficiaryName: "Jane Doe", OriginatorAddress: "1 Main St", RemittanceInfo: "Invoice 42",
+		}
+		sealed, err := sealWireFields(h.enc, wm)
+		require.NoError(t, err)
+		for _, stored := range []string{sealed.beneficiaryName, sealed.originatorAddress, sealed.remittanceInfo} {
+			assert.True(t, encryption.IsEncrypted(stored))
+		}
+		// unset fields stay empty rather than encrypting nothing
+		assert.Empty(t, sealed.beneficiaryAddress)
+		assert.Empty(t, sealed.originatorName)
+
+		stored := models.WireMessage{
+			SenderAN: sealed.senderAN, ReceiverAN: sealed.receiverAN, RawMessage: sealed.rawMessage,
+			BeneficiaryName: sealed.beneficiaryName, OriginatorAddress: sealed.originatorAddress, RemittanceInfo: sealed.remittanceInfo,
+		}
+		require.NoError(t, h.openWireMessage(&stored))
+		assert.Equal(t, wm, stored)
+
+		// each field is bound to its own column
+		stored = models.WireMessage{SenderAN: sealed.senderAN, ReceiverAN: sealed.receiverAN, RawMessage: sealed.rawMessage, OriginatorName: sealed.beneficiaryName}
+		assert.Error(t, h.openWireMessage(&stored))
+	})
+}
@@ -20,7 +20,13 @@ const Login = () => {
         body: `username=${credentials.username}&password=${credentials.password}`,
       });
 
-      if (response.ok) navigate("/wire-messages");
+      if (response.ok) {
+        navigate("/wire-messages");
+        return;
+      }
+      const problem = await response.json();
+      if (problem.code === "RATE_LIMITED")
+        setError("Too many login attempts, please wait and try again");
       else setError("Invalid credentials");
     } catch {
       setError("An error occurred during login");
@@ -11,6 +11,7 @@ interface WireMessage {
   receiver_an: string;
   amount: number;
   message: string;
+  created_by: string;
 }
 
 // Number of wire messages to display per page
@@ -19,6 +20,32 @@ const ITEMS_PER_PAGE = 5;
 // Backend API endpoint
 const API_URL = "http://localhost:8080";
 
+// Problem describes an RFC 7807 error returned by the backend
+interface Problem {
+  code: string;
+  detail?: string;
+  errors?: { pointer?: string; code: string; detail: string }[];
+}
+
+// Messages for error codes the form can explain; the backend's detail is
+// used for anything else
+const ERROR_MESSAGES: Record<string, string> = {
+  DUPLICATE_SEQ: "A message with this sequence number already exists",
+  INVALID_RTN: "Routing numbers must be 9 digits",
+  INVALID_ACCOUNT: "Account numbers must be digits only",
+  INVALID_AMOUNT: "Amount must be a positive number",
+  RATE_LIMITED: "Too many requests, please wait and try again",
+  AUTHENTICATION_REQUIRED: "Your session has expired, please log in again",
+  INSUFFICIENT_PERMISSIONS: "You are not allowed to submit wire messages",
+};
+
+// describes a problem response, preferring known codes over free text
+const describeProblem = (problem: Problem) =>
+  ERROR_MESSAGES[problem.code] ||
+  problem.errors?.map((e) => e.detail).join("; ") ||
+  problem.detail ||
+  "Failed to submit message";
+
 // WireMessages component handles displaying and creating wire messages
 const WireMessages = () => {
   const [messages, setMessages] = useState<WireMessage[]>([]);
@@ -41,21 +68,29 @@ const WireMessages = () => {
   // Handle new message form submission
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
-    const messageString = `seq=${newMessage.seq};sender_rtn=${newMessage.sender_rtn};sender_an=${newMessage.sender_an};receiver_rtn=${newMessage.receiver_rtn};receiver_an=${newMessage.receiver_an};amount=${newMessage.amount}`;
+    // routing and account numbers stay strings so leading zeros survive
+    const body = {
+      seq: Number(newMessage.seq),
+      sender_rtn: newMessage.sender_rtn,
+      sender_an: newMessage.sender_an,
+      receiver_rtn: newMessage.receiver_rtn,
+      receiver_an: newMessage.receiver_an,
+      amount: Number(newMessage.amount),
+    };
 
     try {
       const response = await fetch(`${API_URL}/wire-messages`, {
         method: "POST",
         credentials: "include", // Required for cookies
         headers: {
-          "Content-Type": "text/plain",
+          "Content-Type": "application/json",
         },
-        body: messageString,
+        body: JSON.stringify(body),
       });
 
       if (!response.ok) {
-        const errorData = await response.json();
-        setError(errorData.error || "Failed to submit message");
+        const problem: Problem = await response.json();
+        setError(describeProblem(problem));
       } else {
         // Reset form and refresh messages on success
         fetchMessages();
@@ -233,9 +268,7 @@ const WireMessages = () => {
           >
             <option value="seq">Sequence</option>
             <option value="sender_rtn">Sender RTN</option>
-            <option value="sender_an">Sender Account</option>
             <option value="receiver_rtn">Receiver RTN</option>
-            <option value="receiver_an">Receiver Account</option>
             <option value="amount">Amount</option>
           </select>
         </label>